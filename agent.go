@@ -0,0 +1,95 @@
+package simplessh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// forwardAgent serves agent requests from the remote host with the agent the
+// client authenticated with, or the local ssh-agent otherwise, and marks the
+// client so new sessions request forwarding.
+func (c *Client) forwardAgent() error {
+	if c.agent == nil {
+		conn, err := dialAgent()
+		if err != nil {
+			return err
+		}
+		c.agent, c.agentConn = agent.NewClient(conn), conn
+	}
+
+	if err := agent.ForwardToAgent(c.SSHClient, c.agent); err != nil {
+		return err
+	}
+
+	c.agentForwarding = true
+	return nil
+}
+
+// agentSigners returns a callback listing the agent's keys. Keys backed by a
+// FIDO2 security key (sk-ssh-ed25519@openssh.com and
+// sk-ecdsa-sha2-nistp256@openssh.com) are wrapped so they're offered with
+// their own algorithm only and a failed signature explains that the key has to
+// be present and touched instead of reporting a bare agent failure.
+func agentSigners(keyring agent.ExtendedAgent) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		signers, err := keyring.Signers()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, signer := range signers {
+			if isSecurityKey(signer.PublicKey()) {
+				if algSigner, ok := signer.(ssh.AlgorithmSigner); ok {
+					signers[i] = securityKeySigner{algSigner}
+				}
+			}
+		}
+
+		return signers, nil
+	}
+}
+
+// isSecurityKey reports whether key, or the key a certificate is for, is
+// backed by a FIDO2 security key.
+func isSecurityKey(key ssh.PublicKey) bool {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	return strings.HasPrefix(key.Type(), "sk-")
+}
+
+type securityKeySigner struct {
+	ssh.AlgorithmSigner
+}
+
+// Algorithms implements ssh.MultiAlgorithmSigner. Security keys only sign with
+// the algorithm matching their key type.
+func (s securityKeySigner) Algorithms() []string {
+	key := s.PublicKey()
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	return []string{key.Type()}
+}
+
+func (s securityKeySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	sig, err := s.AlgorithmSigner.Sign(rand, data)
+	return sig, s.explain(err)
+}
+
+func (s securityKeySigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	sig, err := s.AlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+	return sig, s.explain(err)
+}
+
+func (s securityKeySigner) explain(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("Security key %s didn't sign, make sure it's plugged in and touch it when it blinks: %w",
+		ssh.FingerprintSHA256(s.PublicKey()), err)
+}
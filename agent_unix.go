@@ -0,0 +1,24 @@
+//go:build !windows
+
+package simplessh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// dialAgent connects to the local ssh-agent pointed to by SSH_AUTH_SOCK.
+func dialAgent() (io.ReadWriteCloser, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("%w: SSH_AUTH_SOCK isn't set, is an ssh-agent running?", ErrAgentUnavailable)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAgentUnavailable, err)
+	}
+	return conn, nil
+}
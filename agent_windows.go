@@ -0,0 +1,33 @@
+//go:build windows
+
+package simplessh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const openSSHAgentPipe = `\\.\pipe\openssh-ssh-agent`
+
+// dialAgent connects to the Windows OpenSSH agent's named pipe, or to the
+// pipe SSH_AUTH_SOCK names if it's set to one. Pageant is used instead when
+// the pipe can't be opened, since many Windows users only run Pageant.
+func dialAgent() (io.ReadWriteCloser, error) {
+	pipe := openSSHAgentPipe
+	if socket := os.Getenv("SSH_AUTH_SOCK"); strings.HasPrefix(socket, `\\.\pipe\`) {
+		pipe = socket
+	}
+
+	conn, err := os.OpenFile(pipe, os.O_RDWR, 0)
+	if err == nil {
+		return conn, nil
+	}
+
+	if pageant, pageantErr := dialPageant(); pageantErr == nil {
+		return pageant, nil
+	}
+
+	return nil, fmt.Errorf("%w: neither the OpenSSH agent nor Pageant is running: %w", ErrAgentUnavailable, err)
+}
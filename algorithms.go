@@ -0,0 +1,280 @@
+package simplessh
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WithCiphers sets the ciphers offered to the server in order of preference,
+// replacing the package defaults. Names not supported by
+// golang.org/x/crypto/ssh are ignored.
+func WithCiphers(ciphers ...string) Option {
+	return func(o *options) {
+		o.config.Ciphers = ciphers
+	}
+}
+
+// WithKeyExchanges sets the key exchange algorithms offered to the server in
+// order of preference, replacing the package defaults.
+func WithKeyExchanges(kexes ...string) Option {
+	return func(o *options) {
+		o.config.KeyExchanges = kexes
+	}
+}
+
+// WithMACs sets the MAC algorithms offered to the server in order of
+// preference, replacing the package defaults.
+func WithMACs(macs ...string) Option {
+	return func(o *options) {
+		o.config.MACs = macs
+	}
+}
+
+// WithRekeyThreshold sets the number of bytes sent or received after which
+// new keys are negotiated, in place of the default suited to the cipher, for
+// long-lived connections moving a lot of data. Values below the package's
+// minimum of 256 bytes are raised to it.
+func WithRekeyThreshold(bytes uint64) Option {
+	return func(o *options) {
+		o.config.RekeyThreshold = bytes
+	}
+}
+
+// WithCompression asks for zlib@openssh.com compression. It's not
+// supported by golang.org/x/crypto/ssh, which only implements "none", so
+// connecting with it fails rather than silently sending data uncompressed.
+func WithCompression() Option {
+	return func(o *options) {
+		o.compression = true
+	}
+}
+
+// WithHostKeyAlgorithms sets the host key algorithms accepted from the
+// server in order of preference, replacing the package defaults.
+func WithHostKeyAlgorithms(algorithms ...string) Option {
+	return func(o *options) {
+		o.hostKeyAlgorithms = algorithms
+	}
+}
+
+// WithPublicKeyAlgorithms restricts the signature algorithms used for public
+// key authentication, such as ssh.KeyAlgoRSASHA512, in order of preference.
+// Keys that can't sign with any of them aren't offered to the server, so
+// ssh.KeyAlgoRSA can be left out to stop RSA keys from signing with SHA-1.
+func WithPublicKeyAlgorithms(algorithms ...string) Option {
+	return func(o *options) {
+		o.publicKeyAlgorithms = algorithms
+	}
+}
+
+// WithStrictAlgorithms limits the connection to algorithms approved for use
+// under FIPS 140: AES ciphers, NIST curve and large group Diffie-Hellman key
+// exchanges, SHA-2 MACs and ECDSA or SHA-2 RSA signatures with RSA keys of at
+// least 2048 bits. Servers that only offer Ed25519 host keys or
+// curve25519 key exchanges can't be connected to with it. Options given after
+// it can loosen or tighten individual lists.
+func WithStrictAlgorithms() Option {
+	return func(o *options) {
+		o.config.Ciphers = []string{
+			ssh.CipherAES256GCM, ssh.CipherAES128GCM,
+			ssh.CipherAES256CTR, ssh.CipherAES192CTR, ssh.CipherAES128CTR,
+		}
+		o.config.KeyExchanges = []string{
+			ssh.KeyExchangeECDHP384, ssh.KeyExchangeECDHP256, ssh.KeyExchangeECDHP521,
+			ssh.KeyExchangeDH16SHA512, ssh.KeyExchangeDH14SHA256,
+		}
+		o.config.MACs = []string{
+			ssh.HMACSHA512ETM, ssh.HMACSHA256ETM, ssh.HMACSHA512, ssh.HMACSHA256,
+		}
+		o.hostKeyAlgorithms = []string{
+			ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA521v01,
+			ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+			ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+		}
+		o.publicKeyAlgorithms = []string{
+			ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+		}
+		o.forbidSHA1 = true
+		if o.minRSABits < 2048 {
+			o.minRSABits = 2048
+		}
+	}
+}
+
+// WithMinRSAKeySize rejects RSA host keys shorter than bits and stops RSA
+// client keys shorter than bits from being offered to the server.
+func WithMinRSAKeySize(bits int) Option {
+	return func(o *options) {
+		o.minRSABits = bits
+	}
+}
+
+// WithoutSHA1 removes every algorithm based on SHA-1 from the key exchanges,
+// MACs, host key and signature algorithms, whichever options set them.
+// Servers still using ssh-rsa signatures can't be connected to with it.
+func WithoutSHA1() Option {
+	return func(o *options) {
+		o.forbidSHA1 = true
+	}
+}
+
+// restrictAlgorithms applies WithoutSHA1 and WithMinRSAKeySize once all of the
+// options have been set. Lists that weren't set start out as every algorithm
+// golang.org/x/crypto/ssh supports.
+func (o *options) restrictAlgorithms() {
+	if o.forbidSHA1 {
+		supported := ssh.SupportedAlgorithms()
+		o.config.KeyExchanges = withoutSHA1(o.config.KeyExchanges, supported.KeyExchanges)
+		o.config.MACs = withoutSHA1(o.config.MACs, supported.MACs)
+		o.hostKeyAlgorithms = withoutSHA1(o.hostKeyAlgorithms, supported.HostKeys)
+		o.publicKeyAlgorithms = withoutSHA1(o.publicKeyAlgorithms, supported.PublicKeyAuths)
+	}
+
+	if o.minRSABits > 0 {
+		o.hostKeyCallback = minRSAHostKey(o.minRSABits, o.hostKeyCallback)
+	}
+}
+
+func withoutSHA1(algorithms, defaults []string) []string {
+	if len(algorithms) == 0 {
+		algorithms = defaults
+	}
+
+	var filtered []string
+	for _, algorithm := range algorithms {
+		switch algorithm {
+		case ssh.KeyAlgoRSA, ssh.KeyAlgoDSA, ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01:
+			continue
+		}
+		if strings.Contains(algorithm, "sha1") {
+			continue
+		}
+		filtered = append(filtered, algorithm)
+	}
+	return filtered
+}
+
+// minRSAHostKey rejects RSA host keys shorter than bits before handing the
+// key to callback.
+func minRSAHostKey(bits int, callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if size := rsaKeySize(key); size > 0 && size < bits {
+			return fmt.Errorf("Host key for %s is a %d bit RSA key, at least %d bits are required", hostname, size, bits)
+		}
+		return callback(hostname, remote, key)
+	}
+}
+
+// rsaKeySize returns the size in bits of an RSA key or of the key of an RSA
+// certificate, 0 for other keys.
+func rsaKeySize(key ssh.PublicKey) int {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok {
+		return rsaKey.N.BitLen()
+	}
+	return 0
+}
+
+// publicKeys is ssh.PublicKeys honoring WithPublicKeyAlgorithms.
+func publicKeys(opts []Option, signers ...ssh.Signer) ssh.AuthMethod {
+	return publicKeysCallback(opts, func() ([]ssh.Signer, error) {
+		return signers, nil
+	})
+}
+
+// publicKeysCallback is ssh.PublicKeysCallback honoring
+// WithPublicKeyAlgorithms and WithMinRSAKeySize.
+func publicKeysCallback(opts []Option, getSigners func() ([]ssh.Signer, error)) ssh.AuthMethod {
+	o := newOptions(opts)
+
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		signers, err := getSigners()
+		if err != nil {
+			o.log().Debug("Couldn't get public keys", "error", err)
+			return nil, err
+		}
+		if len(o.publicKeyAlgorithms) == 0 && o.minRSABits == 0 {
+			logSigners(o.log(), signers)
+			return signers, nil
+		}
+
+		var restricted []ssh.Signer
+		for _, signer := range signers {
+			if size := rsaKeySize(signer.PublicKey()); size > 0 && size < o.minRSABits {
+				continue
+			}
+			if len(o.publicKeyAlgorithms) == 0 {
+				restricted = append(restricted, signer)
+				continue
+			}
+			if signer, ok := restrictSigner(signer, o.publicKeyAlgorithms); ok {
+				restricted = append(restricted, signer)
+			}
+		}
+		logSigners(o.log(), restricted)
+		return restricted, nil
+	})
+}
+
+func logSigners(logger *slog.Logger, signers []ssh.Signer) {
+	fingerprints := make([]string, len(signers))
+	for i, signer := range signers {
+		fingerprints[i] = signer.PublicKey().Type() + " " + ssh.FingerprintSHA256(signer.PublicKey())
+	}
+	logger.Debug("Offering public keys", "keys", fingerprints)
+}
+
+// restrictSigner limits signer to the allowed algorithms it supports,
+// reporting false if there are none.
+func restrictSigner(signer ssh.Signer, allowed []string) (ssh.Signer, bool) {
+	key := signer.PublicKey()
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+
+	supported := []string{key.Type()}
+	switch s := signer.(type) {
+	case ssh.MultiAlgorithmSigner:
+		supported = s.Algorithms()
+	case ssh.AlgorithmSigner:
+		if key.Type() == ssh.KeyAlgoRSA {
+			supported = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+	}
+
+	var algorithms []string
+	for _, algorithm := range allowed {
+		if slices.Contains(supported, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, false
+	}
+
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		// Only the key's own algorithm is supported and it's allowed.
+		return signer, true
+	}
+
+	restricted, err := ssh.NewSignerWithAlgorithms(algorithmSigner, algorithms)
+	if err != nil {
+		return nil, false
+	}
+	return restricted, true
+}
@@ -0,0 +1,171 @@
+package simplessh
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultRedactions are the patterns an AuditLog uses when Redact is nil. They
+// cover password, secret, token and API key assignments and flags, sshpass -p,
+// Authorization headers and passwords in URLs.
+var DefaultRedactions = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|token|api[_-]?key)\s*[=:]\s*("[^"]*"|'[^']*'|[^\s;&|]+)`),
+	regexp.MustCompile(`(?i)--(?:password|passwd|secret|token|api[_-]?key)\s+("[^"]*"|'[^']*'|[^\s;&|]+)`),
+	regexp.MustCompile(`\bsshpass\s+-p\s*("[^"]*"|'[^']*'|\S+)`),
+	regexp.MustCompile(`(?i)authorization:\s*(?:bearer|basic|token)\s+([^\s"']+)`),
+	regexp.MustCompile(`://[^/\s:@]+:([^/\s@]+)@`),
+}
+
+const redacted = "[REDACTED]"
+
+// An AuditLog writes a JSON line for every command run by Exec and the
+// functions built on it, with the secrets in it redacted. A single
+// AuditLog can be shared by many clients.
+type AuditLog struct {
+	// Writer receives one JSON encoded AuditRecord per line.
+	Writer io.Writer
+
+	// Initiator identifies who ran the commands, defaults to the local
+	// user@hostname.
+	Initiator string
+
+	// Redact are the patterns removed from commands and errors. When a
+	// pattern has capture groups only the groups are replaced, otherwise the
+	// whole match is. DefaultRedactions are used if nil.
+	Redact []*regexp.Regexp
+
+	once sync.Once
+	mu   sync.Mutex
+}
+
+// An AuditRecord describes a command that was run.
+type AuditRecord struct {
+	Time            time.Time `json:"time"`
+	Initiator       string    `json:"initiator"`
+	Host            string    `json:"host"`
+	User            string    `json:"user"`
+	Command         string    `json:"command"`
+	DurationSeconds float64   `json:"duration_seconds"`
+
+	// ExitStatus is -1 if the command didn't exit normally, because it was
+	// killed by a signal or the session failed.
+	ExitStatus int    `json:"exit_status"`
+	Signal     string `json:"signal,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WithAuditLog records every command run on the connection to log.
+func WithAuditLog(log *AuditLog) Option {
+	return func(o *options) {
+		o.audit = log
+	}
+}
+
+// Record redacts r's command and error and writes it as a JSON line.
+func (l *AuditLog) Record(r AuditRecord) error {
+	l.once.Do(func() {
+		if l.Initiator == "" {
+			l.Initiator = localInitiator()
+		}
+	})
+	if r.Initiator == "" {
+		r.Initiator = l.Initiator
+	}
+	r.Command = l.RedactString(r.Command)
+	r.Error = l.RedactString(r.Error)
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.Writer.Write(append(data, '\n'))
+	return err
+}
+
+// RedactString returns s with everything matching the Redact patterns
+// replaced by [REDACTED].
+func (l *AuditLog) RedactString(s string) string {
+	patterns := l.Redact
+	if patterns == nil {
+		patterns = DefaultRedactions
+	}
+	for _, pattern := range patterns {
+		s = redact(pattern, s)
+	}
+	return s
+}
+
+func redact(pattern *regexp.Regexp, s string) string {
+	if pattern.NumSubexp() == 0 {
+		return pattern.ReplaceAllLiteralString(s, redacted)
+	}
+
+	var b []byte
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(s, -1) {
+		for group := 1; group*2 < len(match); group++ {
+			start, end := match[group*2], match[group*2+1]
+			if start < last {
+				continue
+			}
+			b = append(b, s[last:start]...)
+			b = append(b, redacted...)
+			last = end
+		}
+	}
+	if b == nil {
+		return s
+	}
+	return string(append(b, s[last:]...))
+}
+
+// audit records cmd having run with the outcome err.
+func (c *Client) audit(cmd string, start time.Time, err error) {
+	if c.auditLog == nil {
+		return
+	}
+
+	r := AuditRecord{
+		Time:            start,
+		Host:            c.host,
+		User:            c.user,
+		Command:         cmd,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	var exitErr *ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		r.ExitStatus, r.Signal = exitErr.Status, exitErr.Signal
+	default:
+		r.ExitStatus = -1
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	if err := c.auditLog.Record(r); err != nil {
+		c.log().Warn("Writing the audit log failed", "error", err)
+	}
+}
+
+func localInitiator() string {
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return username
+	}
+	return username + "@" + hostname
+}
@@ -0,0 +1,158 @@
+package simplessh
+
+import (
+	"os"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// An AuthChain lists the ways to authenticate that are tried, in order, until
+// the server accepts one: the ssh-agent, then the key files, then the password.
+// Methods that aren't configured or aren't available are skipped, so a chain
+// can be written once and used on machines with and without an agent.
+type AuthChain struct {
+	// Agent enables authentication with the local ssh-agent, see
+	// ConnectWithSshAgent.
+	Agent bool
+
+	// KeyFiles are private key files to offer. Files that can't be read or
+	// parsed are skipped.
+	KeyFiles []string
+
+	// Passphrase is asked for the passphrase of encrypted key files. The key
+	// files are only loaded once the server is ready to try them, so it isn't
+	// called when the agent already got the client in. Encrypted key files
+	// are skipped when it's nil.
+	Passphrase PassphraseFunc
+
+	// Password is called when the server asks for a password, which only
+	// happens once the other methods have been rejected.
+	Password func() (string, error)
+
+	// KeyboardInteractive answers the server's keyboard-interactive
+	// challenges, which is how most servers ask for one-time codes.
+	KeyboardInteractive ssh.KeyboardInteractiveChallenge
+}
+
+// Connect trying each method of the chain in turn, mirroring how ssh falls
+// back from one method to the next. If username is empty simplessh will attempt to get the current user.
+func ConnectWithAuthChain(host, username string, chain AuthChain, opts ...Option) (*Client, error) {
+	return ConnectWithAuthChainTimeout(host, username, chain, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithAuthChain but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithAuthChainTimeout(host, username string, chain AuthChain, timeout time.Duration, opts ...Option) (*Client, error) {
+	var methods []ssh.AuthMethod
+
+	if chain.Agent {
+		if conn, err := dialAgent(); err == nil {
+			keyring := agent.NewClient(conn)
+			methods = append(methods, publicKeysCallback(opts, agentSigners(keyring)))
+			opts = append(opts, withAgent(keyring, conn))
+		}
+	}
+
+	methods = append(methods, chain.methods(opts)...)
+
+	return connect(username, host, methods, timeout, opts)
+}
+
+// methods returns the auth methods of the chain besides the agent.
+func (chain AuthChain) methods(opts []Option) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+
+	if len(chain.KeyFiles) > 0 {
+		methods = append(methods, publicKeysCallback(opts, func() ([]ssh.Signer, error) {
+			return loadSigners(chain.KeyFiles, chain.Passphrase), nil
+		}))
+	}
+
+	if chain.Password != nil {
+		methods = append(methods, ssh.PasswordCallback(chain.Password))
+	}
+
+	if chain.KeyboardInteractive != nil {
+		methods = append(methods, ssh.KeyboardInteractive(chain.KeyboardInteractive))
+	}
+
+	return methods
+}
+
+// Connect answering the server's keyboard-interactive challenges with
+// challenge, which is called once per round with the prompts the server sent.
+// If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyboardInteractive(host, username string, challenge ssh.KeyboardInteractiveChallenge, opts ...Option) (*Client, error) {
+	return ConnectWithKeyboardInteractiveTimeout(host, username, challenge, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithKeyboardInteractive but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyboardInteractiveTimeout(host, username string, challenge ssh.KeyboardInteractiveChallenge, timeout time.Duration, opts ...Option) (*Client, error) {
+	authMethod := ssh.KeyboardInteractive(challenge)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// Connect to a server that requires a password followed by a verification
+// code. otp is called for every prompt that doesn't ask for the password, so it
+// can read the code from the user or generate it from a TOTP secret. Both
+// servers that ask for everything through keyboard-interactive and those that
+// require password and then keyboard-interactive authentication are handled.
+// If username is empty simplessh will attempt to get the current user.
+func ConnectWithPasswordAndOTP(host, username, pass string, otp func() (string, error), opts ...Option) (*Client, error) {
+	return ConnectWithPasswordAndOTPTimeout(host, username, pass, otp, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithPasswordAndOTP but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithPasswordAndOTPTimeout(host, username, pass string, otp func() (string, error), timeout time.Duration, opts ...Option) (*Client, error) {
+	authMethods := []ssh.AuthMethod{
+		ssh.Password(pass),
+		ssh.KeyboardInteractive(PasswordAndOTPChallenge(pass, otp)),
+	}
+
+	return connect(username, host, authMethods, timeout, opts)
+}
+
+var passwordPrompt = regexp.MustCompile(`(?i)password`)
+
+// PasswordAndOTPChallenge returns a keyboard-interactive challenge that answers
+// prompts mentioning a password with pass and every other prompt with a code
+// from otp.
+func PasswordAndOTPChallenge(pass string, otp func() (string, error)) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			if passwordPrompt.MatchString(question) {
+				answers[i] = pass
+				continue
+			}
+
+			code, err := otp()
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = code
+		}
+		return answers, nil
+	}
+}
+
+// loadSigners parses private key files, skipping those that can't be read or
+// are encrypted and couldn't be decrypted with passphrase.
+func loadSigners(files []string, passphrase PassphraseFunc) []ssh.Signer {
+	var signers []ssh.Signer
+	for _, file := range files {
+		privKey, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		signer, err := ParsePrivateKey(privKey, file, passphrase)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
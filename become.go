@@ -0,0 +1,245 @@
+package simplessh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A BecomeMethod is the program used to run commands as another user.
+type BecomeMethod int
+
+const (
+	// Sudo runs commands with sudo.
+	Sudo BecomeMethod = iota
+
+	// Su runs commands with su. A password needs a pseudo-terminal, which
+	// merges stderr into stdout.
+	Su
+
+	// Doas runs commands with doas. A password needs a pseudo-terminal, which
+	// merges stderr into stdout.
+	Doas
+)
+
+func (m BecomeMethod) String() string {
+	switch m {
+	case Su:
+		return "su"
+	case Doas:
+		return "doas"
+	}
+	return "sudo"
+}
+
+// Become runs commands as another user on the remote host, root by default.
+// The password, if any, is sent when the method prompts for it, and the
+// method's output up to the point the command starts is dropped. Become
+// applies to Exec and everything built on it, it doesn't apply to SFTP
+// transfers such as Upload and Download. Scripts run with RunScript are only
+// readable by the connecting user and root. Become needs a POSIX shell on
+// the remote host.
+type Become struct {
+	Method BecomeMethod
+
+	// User to run commands as, root if empty.
+	User string
+
+	// Password to answer the prompt with. If empty, becoming the user fails
+	// if a password is asked for.
+	Password string
+}
+
+// WithBecome runs every command on the connection as described by become.
+func WithBecome(become *Become) Option {
+	return func(o *options) {
+		o.become = become
+	}
+}
+
+// WithExecBecome runs the command as described by become, overriding the one
+// given to WithBecome. A nil become runs it as the connecting user.
+func WithExecBecome(become *Become) ExecOption {
+	return func(o *execOptions) {
+		o.become = become
+		o.becomeSet = true
+	}
+}
+
+// becomeFor returns how the command is run elevated given the client's
+// default, nil if it isn't.
+func (o *execOptions) becomeFor(c *Client) *Become {
+	if o.becomeSet {
+		return o.become
+	}
+	return c.become
+}
+
+// genericPrompt matches the password prompts of su and doas.
+var genericPrompt = regexp.MustCompile(`(?i)password[^\n:]*:`)
+
+// A becomeSession runs a command elevated. It answers the password prompt
+// and passes output on once the marker printed by the elevated shell shows
+// the command has started.
+type becomeSession struct {
+	become  *Become
+	user    string
+	id      string
+	marker  []byte
+	prompt  *regexp.Regexp
+	needPTY bool
+	stdin   io.WriteCloser
+	input   io.Reader
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	searched int
+	prompted bool
+	started  bool
+}
+
+func (c *Client) newBecomeSession(become *Become) (*becomeSession, error) {
+	if c.platform.Windows() {
+		return nil, errors.New("Become isn't supported on Windows hosts")
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	b := &becomeSession{
+		become: become,
+		user:   become.User,
+		id:     hex.EncodeToString(random),
+		prompt: genericPrompt,
+	}
+	b.marker = []byte("__simplessh_become_" + b.id + "_started")
+	if b.user == "" {
+		b.user = "root"
+	}
+	return b, nil
+}
+
+// command returns cmd wrapped to run as the user.
+func (b *becomeSession) command(cmd string) (string, error) {
+	shell := "sh -c " + Quote("printf '%s\\n' "+string(b.marker)+" >&2; "+cmd)
+
+	switch b.become.Method {
+	case Sudo:
+		prompt := "[sudo " + b.id + "] password: "
+		b.prompt = regexp.MustCompile(regexp.QuoteMeta(prompt))
+		return "sudo -S -p " + Quote(prompt) + " -u " + Quote(b.user) + " -- " + shell, nil
+	case Su:
+		b.needPTY = b.become.Password != ""
+		return "su " + Quote(b.user) + " -c " + Quote(shell), nil
+	case Doas:
+		if b.become.Password != "" {
+			b.needPTY = true
+			return "doas -u " + Quote(b.user) + " " + shell, nil
+		}
+		return "doas -n -u " + Quote(b.user) + " " + shell, nil
+	}
+	return "", fmt.Errorf("Unknown become method %d", b.become.Method)
+}
+
+// attach connects to the session's stdin, to feed input to the command once
+// it has started, and returns the writers to use for its stdout and stderr.
+// The prompt and the marker end up on stdout when there's a pseudo-terminal
+// and on stderr otherwise.
+func (b *becomeSession) attach(session *ssh.Session, input io.Reader, stdout, stderr io.Writer, pty bool) (io.Writer, io.Writer, error) {
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	b.stdin, b.input = stdin, input
+
+	if pty {
+		return &becomeWriter{b: b, w: stdout}, stderr, nil
+	}
+	return stdout, &becomeWriter{b: b, w: stderr}, nil
+}
+
+// result turns the error of the elevated command into one explaining why
+// becoming the user failed if the command didn't start.
+func (b *becomeSession) result(err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.started || err == nil {
+		return err
+	}
+	if b.stdin != nil {
+		b.stdin.Close()
+	}
+
+	msg := strings.TrimSpace(b.prompt.ReplaceAllString(b.buf.String(), ""))
+	if msg == "" {
+		return fmt.Errorf("Couldn't become %s with %s: %w: %w", b.user, b.become.Method, ErrBecomeFailed, err)
+	}
+	return fmt.Errorf("Couldn't become %s with %s: %s: %w", b.user, b.become.Method, msg, ErrBecomeFailed)
+}
+
+// becomeWriter watches the stream the prompt and marker are written to.
+type becomeWriter struct {
+	b *becomeSession
+	w io.Writer
+}
+
+func (w *becomeWriter) Write(p []byte) (int, error) {
+	b := w.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.started {
+		return w.w.Write(p)
+	}
+
+	b.buf.Write(p)
+	data := b.buf.Bytes()
+
+	if i := bytes.Index(data, b.marker); i >= 0 {
+		end := bytes.IndexByte(data[i:], '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		b.started = true
+		// Nothing but the input is read from stdin after the password,
+		// commands get EOF after it as they would without Become.
+		if b.input == nil {
+			b.stdin.Close()
+		} else {
+			go func() {
+				io.Copy(b.stdin, b.input)
+				b.stdin.Close()
+			}()
+		}
+		if _, err := w.w.Write(data[i+end+1:]); err != nil {
+			return 0, err
+		}
+		b.buf.Reset()
+		return len(p), nil
+	}
+
+	if loc := b.prompt.FindIndex(data[b.searched:]); loc != nil {
+		b.searched += loc[1]
+		if b.prompted || b.become.Password == "" {
+			// A second prompt means the password was wrong, closing stdin
+			// makes the method give up instead of waiting.
+			b.stdin.Close()
+		} else {
+			b.prompted = true
+			io.WriteString(b.stdin, b.become.Password+"\n")
+		}
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,139 @@
+package simplessh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// A BenchmarkReport is the result of Client.Benchmark.
+type BenchmarkReport struct {
+	Host string
+
+	// The round-trip latency of running a command, over 5 runs.
+	MinLatency time.Duration
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+
+	// Bytes is the amount of data uploaded and then downloaded again.
+	Bytes        int64
+	UploadTime   time.Duration
+	DownloadTime time.Duration
+
+	// UploadBPS and DownloadBPS are in bytes per second.
+	UploadBPS   float64
+	DownloadBPS float64
+}
+
+func (r *BenchmarkReport) String() string {
+	return fmt.Sprintf("%s: latency min %v avg %v max %v, upload %.1f MB/s, download %.1f MB/s",
+		r.Host, r.MinLatency, r.AvgLatency, r.MaxLatency, r.UploadBPS/1e6, r.DownloadBPS/1e6)
+}
+
+const (
+	benchmarkRoundTrips = 5
+	benchmarkBytes      = 16 << 20
+)
+
+// Benchmark measures the round-trip latency of running a command on the
+// remote host and the throughput of uploading and downloading a temporary
+// file of random data, which is removed afterwards, for diagnosing slow
+// connections. It stops early with ctx's error when ctx is done. In dry-run
+// mode only the latency is measured, leaving Bytes and the throughput zero.
+func (c *Client) Benchmark(ctx context.Context) (*BenchmarkReport, error) {
+	report := &BenchmarkReport{Host: c.host}
+
+	var total time.Duration
+	for i := range benchmarkRoundTrips {
+		start := time.Now()
+		if _, err := c.Exec("echo simplessh", readOnly, WithCommandContext(ctx)); err != nil {
+			return nil, fmt.Errorf("Couldn't measure latency: %w", err)
+		}
+		latency := time.Since(start)
+
+		total += latency
+		if i == 0 || latency < report.MinLatency {
+			report.MinLatency = latency
+		}
+		report.MaxLatency = max(report.MaxLatency, latency)
+	}
+	report.AvgLatency = total / benchmarkRoundTrips
+
+	if c.DryRun() {
+		return report, nil
+	}
+	report.Bytes = benchmarkBytes
+
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer client.Close()
+	defer c.openChannel("sftp")()
+
+	remote, err := atomicTemp(c.remotePath("simplessh-benchmark"))
+	if err != nil {
+		return nil, err
+	}
+	remoteFile, err := client.Create(remote)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't measure throughput: %w", err)
+	}
+	defer client.Remove(remote)
+
+	random := rand.NewChaCha8([32]byte{})
+	start := time.Now()
+	_, err = io.Copy(remoteFile, &ctxReader{ctx, io.LimitReader(random, benchmarkBytes)})
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't measure upload throughput: %w", err)
+	}
+	report.UploadTime = time.Since(start)
+
+	remoteFile, err = client.Open(remote)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't measure download throughput: %w", err)
+	}
+	defer remoteFile.Close()
+
+	start = time.Now()
+	if _, err := io.Copy(&ctxWriter{ctx, io.Discard}, remoteFile); err != nil {
+		return nil, fmt.Errorf("Couldn't measure download throughput: %w", err)
+	}
+	report.DownloadTime = time.Since(start)
+
+	report.UploadBPS = float64(benchmarkBytes) / report.UploadTime.Seconds()
+	report.DownloadBPS = float64(benchmarkBytes) / report.DownloadTime.Seconds()
+	return report, nil
+}
+
+// ctxReader stops reading from r once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ctxWriter stops writing to w once ctx is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
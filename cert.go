@@ -0,0 +1,88 @@
+package simplessh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connect with a private key and an OpenSSH user certificate signed for it.
+// If certPath is empty it defaults to the key path with "-cert.pub" appended,
+// the name ssh-keygen gives certificates. If username is empty simplessh will attempt to get the current user.
+func ConnectWithCertificate(host, username, keyPath, certPath string, opts ...Option) (*Client, error) {
+	return ConnectWithCertificateTimeout(host, username, keyPath, certPath, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithCertificate but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithCertificateTimeout(host, username, keyPath, certPath string, timeout time.Duration, opts ...Option) (*Client, error) {
+	signer, err := LoadCertSigner(keyPath, certPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	authMethod := publicKeys(opts, signer)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// LoadCertSigner loads a private key and the user certificate for it and
+// returns a signer that authenticates with the certificate. The key may be in
+// any format ParsePrivateKey understands and passphrase is used if it's
+// encrypted. An empty certPath defaults to keyPath + "-cert.pub".
+func LoadCertSigner(keyPath, certPath string, passphrase PassphraseFunc) (ssh.Signer, error) {
+	privKey, err := readKeyFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ParsePrivateKey(privKey, keyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if certPath == "" {
+		if keyPath == "" {
+			return nil, errors.New("Certificate path can't be derived from the default key")
+		}
+		certPath = keyPath + "-cert.pub"
+	}
+
+	certBytes, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := ParseCertificate(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", certPath, err)
+	}
+
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// ParseCertificate parses a user certificate in the authorized_keys format
+// ssh-keygen writes, checking that it isn't a host certificate and hasn't expired.
+func ParseCertificate(data []byte) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("Not an SSH certificate")
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, errors.New("Not a user certificate")
+	}
+
+	now := uint64(time.Now().Unix())
+	if cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore {
+		return nil, fmt.Errorf("Certificate expired at %s", time.Unix(int64(cert.ValidBefore), 0))
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,121 @@
+package simplessh
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A CircuitBreaker stops connection attempts to hosts that keep failing, so
+// callers managing many hosts get an immediate *CircuitOpenError instead of
+// waiting for a timeout every time. After Threshold consecutive transient
+// failures, as classified by IsTransient, a host's circuit opens for Cooldown.
+// Once that's over a single attempt is let through as a probe: if it succeeds
+// the circuit closes, otherwise it opens for another Cooldown. One
+// CircuitBreaker is meant to be shared by every connection, with WithCircuitBreaker.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures that opens the
+	// circuit, 5 if zero.
+	Threshold int
+
+	// Cooldown is how long the circuit stays open before a probe is let
+	// through, 30 seconds if zero.
+	Cooldown time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// A CircuitOpenError is returned instead of connecting to a host whose
+// circuit is open.
+type CircuitOpenError struct {
+	Host string
+
+	// Until is when the next probe will be let through.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Circuit for %s is open after repeated failures, retrying after %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// WithCircuitBreaker checks with breaker before every connection attempt and
+// reports the outcome to it.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = breaker
+	}
+}
+
+// allow reports whether an attempt to connect to host may be made now.
+func (b *CircuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.hosts[host]
+	if c == nil || c.openUntil.IsZero() {
+		return nil
+	}
+
+	if c.probing || time.Now().Before(c.openUntil) {
+		return &CircuitOpenError{Host: host, Until: c.openUntil}
+	}
+
+	c.probing = true
+	return nil
+}
+
+// record reports the outcome of an attempt allowed by allow.
+func (b *CircuitBreaker) record(host string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.hosts == nil {
+		b.hosts = make(map[string]*circuit)
+	}
+	c := b.hosts[host]
+	if c == nil {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	c.probing = false
+
+	if !IsTransient(err) {
+		// Errors like failed authentication show the host is reachable.
+		c.failures = 0
+		c.openUntil = time.Time{}
+		return
+	}
+
+	c.failures++
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if c.failures >= threshold || !c.openUntil.IsZero() {
+		cooldown := b.Cooldown
+		if cooldown <= 0 {
+			cooldown = 30 * time.Second
+		}
+		c.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+// State returns the number of consecutive failures recorded for host, where
+// host is in host:port form, and whether its circuit is currently open.
+func (b *CircuitBreaker) State(host string) (failures int, open bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.hosts[host]
+	if c == nil {
+		return 0, false
+	}
+	return c.failures, !c.openUntil.IsZero() && (c.probing || time.Now().Before(c.openUntil))
+}
@@ -0,0 +1,29 @@
+package simplessh
+
+import (
+	"os"
+	"text/template"
+)
+
+// Clienter is what applications typically use of a Client: running commands,
+// transferring files and the file helpers. Code that accepts a Clienter
+// instead of a *Client can be tested with simplesshtest.Fake.
+type Clienter interface {
+	Exec(cmd string, opts ...ExecOption) ([]byte, error)
+	ExecWithOutputStreams(cmd string, opts ...ExecOption) ([]byte, []byte, error)
+	RunScript(path string, args []string, opts ...ExecOption) ([]byte, error)
+
+	Upload(local, remote string, opts ...TransferOption) error
+	Download(remote, local string, opts ...TransferOption) error
+	ReadAll(filepath string) ([]byte, error)
+	Rename(oldpath, newpath string) error
+	StatVFS(path string) (*VFSStat, error)
+
+	EnsureFile(path string, content []byte, mode os.FileMode, owner string) (bool, error)
+	UploadTemplate(tmpl *template.Template, data any, remotePath string, mode os.FileMode) error
+	LineInFile(path, match, line string, ensurePresent bool) (bool, error)
+
+	Close() error
+}
+
+var _ Clienter = (*Client)(nil)
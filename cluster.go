@@ -0,0 +1,108 @@
+package simplessh
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A HostResult is the outcome of a multi-host run on one host.
+type HostResult struct {
+	Host string
+
+	// Result is what ExecFull returned for runs of a command, nil otherwise.
+	Result *ExecResult
+
+	// Err is nil if the run on the host succeeded.
+	Err error
+}
+
+// Results are the outcomes of a multi-host run, one per host.
+type Results []HostResult
+
+// ExecEach runs cmd on all of clients at the same time with ExecFull and
+// returns the results in the order of clients.
+func ExecEach(clients []*Client, cmd string, opts ...ExecOption) Results {
+	results := make(Results, len(clients))
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *Client) {
+			defer wg.Done()
+			result, err := client.ExecFull(cmd, opts...)
+			results[i] = HostResult{Host: client.host, Result: result, Err: err}
+		}(i, client)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Failed returns the results of the hosts where the run failed.
+func (r Results) Failed() Results {
+	var failed Results
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Succeeded returns the results of the hosts where the run succeeded.
+func (r Results) Succeeded() Results {
+	var succeeded Results
+	for _, result := range r {
+		if result.Err == nil {
+			succeeded = append(succeeded, result)
+		}
+	}
+	return succeeded
+}
+
+// ByHost returns the results keyed by host.
+func (r Results) ByHost() map[string]HostResult {
+	byHost := make(map[string]HostResult, len(r))
+	for _, result := range r {
+		byHost[result.Host] = result
+	}
+	return byHost
+}
+
+// Err returns a *ClusterError if the run failed on any host, nil otherwise.
+func (r Results) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &ClusterError{Total: len(r), Failed: failed}
+}
+
+// A ClusterError is returned by Results.Err when a multi-host run failed on
+// some of the hosts. errors.Is and errors.As look through the errors of all of
+// the failed hosts.
+type ClusterError struct {
+	// Total is the number of hosts run on.
+	Total int
+
+	// Failed are the results of the hosts where the run failed.
+	Failed Results
+}
+
+func (e *ClusterError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d/%d hosts failed", len(e.Failed), e.Total)
+	for _, result := range e.Failed {
+		fmt.Fprintf(&b, "\n%s: %v", result.Host, result.Err)
+	}
+	return b.String()
+}
+
+func (e *ClusterError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, result := range e.Failed {
+		errs[i] = result.Err
+	}
+	return errs
+}
@@ -0,0 +1,389 @@
+package simplessh
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeltaStats describes an UploadDelta.
+type DeltaStats struct {
+	// Size of the local file.
+	Size int64
+
+	// Sent is the number of bytes of file data sent: the changed parts for a
+	// delta transfer, the whole file otherwise.
+	Sent int64
+
+	// Delta reports whether a delta transfer was used instead of a plain
+	// upload.
+	Delta bool
+}
+
+// UploadDelta uploads local to remote like Upload, but if remote already
+// exists only the parts of local that aren't in it are sent, as rsync does.
+// The remote host computes checksums of the blocks of remote, the local file
+// is scanned for those blocks with a rolling checksum, and the remote host
+// rebuilds the file from the blocks it has and the data it's sent before
+// atomically replacing remote, keeping its permissions. This suits large
+// files that change a little between uploads.
+//
+// The remote side needs python3. Without it, on Windows hosts and when remote
+// doesn't exist yet, UploadDelta falls back to a plain SFTP upload.
+func (c *Client) UploadDelta(local, remote string) (*DeltaStats, error) {
+	if c.planned(PlannedAction{Kind: "upload", Local: local, Remote: remote}) {
+		return &DeltaStats{}, nil
+	}
+
+	file, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	stats := &DeltaStats{Size: info.Size()}
+
+	blockSize := deltaBlockSize(info.Size())
+	var signatures map[uint32][]deltaBlock
+	if !c.platform.Windows() {
+		signatures, err = c.deltaSignatures(remote, blockSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if signatures == nil {
+		c.log().Debug("Delta transfer unavailable, uploading the whole file", "remote", remote)
+		if err := c.Upload(local, remote); err != nil {
+			return nil, err
+		}
+		stats.Sent = stats.Size
+		return stats, nil
+	}
+	stats.Delta = true
+
+	start := time.Now()
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sent, err := writeDelta(pw, file, blockSize, signatures)
+		stats.Sent = sent
+		pw.CloseWithError(err)
+	}()
+
+	_, err = c.fileExec(deltaPython(deltaApply, remote, blockSize), pr)
+	// The writer gives up if the remote side stopped reading.
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+
+	c.logTransfer("Delta upload", remote, local, stats.Sent, start, err)
+	c.transferred("upload", remote, local, stats.Sent, start, 0, err)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't upload %s: %w", remote, err)
+	}
+	return stats, nil
+}
+
+// deltaBlockSize picks a block size near the square root of the file size,
+// as rsync does, between 2KiB and 128KiB.
+func deltaBlockSize(size int64) int {
+	block := int(math.Sqrt(float64(size)))
+	block = (block + 1023) / 1024 * 1024
+	return min(max(block, 2048), 128*1024)
+}
+
+// deltaSignatures returns the checksums of the full blocks of remote by weak
+// checksum. It returns nil if remote doesn't exist or python3 isn't there.
+func (c *Client) deltaSignatures(remote string, blockSize int) (map[uint32][]deltaBlock, error) {
+	script := `command -v python3 >/dev/null 2>&1 || { echo unavailable; exit 0; }
+[ -f ` + Quote(remote) + ` ] || { echo unavailable; exit 0; }
+echo available
+` + deltaPython(deltaSign, remote, blockSize)
+
+	output, err := c.fileExec(script, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't compute checksums of %s: %w", remote, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if lines[0] != "available" {
+		return nil, nil
+	}
+
+	signatures := map[uint32][]deltaBlock{}
+	for i, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Couldn't compute checksums of %s: unexpected output %q", remote, line)
+		}
+		if fields[2] != strconv.Itoa(blockSize) {
+			// Only the last block can be short and it's sent as data.
+			continue
+		}
+		weak, err1 := strconv.ParseUint(fields[0], 16, 32)
+		strong, err2 := hex.DecodeString(fields[1])
+		if err := errors.Join(err1, err2); err != nil || len(strong) != sha256.Size {
+			return nil, fmt.Errorf("Couldn't compute checksums of %s: unexpected output %q", remote, line)
+		}
+
+		block := deltaBlock{index: uint64(i)}
+		copy(block.strong[:], strong)
+		signatures[uint32(weak)] = append(signatures[uint32(weak)], block)
+	}
+	return signatures, nil
+}
+
+// A deltaBlock is a block of the remote file.
+type deltaBlock struct {
+	index  uint64
+	strong [sha256.Size]byte
+}
+
+// The delta sent to the remote side is a sequence of operations: 'C' with
+// the index of the first block and the number of blocks to copy from the
+// remote file, 'L' with a length and that much data, and finally 'E' with
+// the SHA-256 of the whole file.
+const (
+	deltaCopy    = 'C'
+	deltaLiteral = 'L'
+	deltaEnd     = 'E'
+
+	// deltaMaxLiteral is the most data sent in one operation.
+	deltaMaxLiteral = 1 << 20
+)
+
+// writeDelta writes the delta of r against the blocks in signatures to w and
+// returns the number of bytes of data it contained.
+func writeDelta(w io.Writer, r io.Reader, blockSize int, signatures map[uint32][]deltaBlock) (int64, error) {
+	out := bufio.NewWriterSize(w, 64*1024)
+	hash := sha256.New()
+	in := io.TeeReader(r, hash)
+
+	var sent int64
+	var copyStart, copyCount uint64
+	flushCopy := func() error {
+		if copyCount == 0 {
+			return nil
+		}
+		op := binary.BigEndian.AppendUint64([]byte{deltaCopy}, copyStart)
+		op = binary.BigEndian.AppendUint32(op, uint32(copyCount))
+		copyCount = 0
+		_, err := out.Write(op)
+		return err
+	}
+	literal := func(data []byte) error {
+		if len(data) == 0 {
+			return nil
+		}
+		if err := flushCopy(); err != nil {
+			return err
+		}
+		op := binary.BigEndian.AppendUint32([]byte{deltaLiteral}, uint32(len(data)))
+		if _, err := out.Write(op); err != nil {
+			return err
+		}
+		sent += int64(len(data))
+		_, err := out.Write(data)
+		return err
+	}
+
+	// buf holds the data not sent yet, start is where the window of
+	// blockSize bytes being matched begins.
+	var buf []byte
+	start := 0
+	eof := false
+	chunk := make([]byte, 64*1024)
+	fill := func(n int) error {
+		for !eof && len(buf) < n {
+			m, err := in.Read(chunk)
+			buf = append(buf, chunk[:m]...)
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var weak rollingChecksum
+	valid := false
+	for {
+		if err := fill(start + blockSize + 1); err != nil {
+			return sent, err
+		}
+		if len(buf)-start < blockSize {
+			break
+		}
+
+		window := buf[start : start+blockSize]
+		if !valid {
+			weak.reset(window)
+			valid = true
+		}
+
+		if block, ok := matchBlock(signatures, weak.sum(), window); ok {
+			if err := literal(buf[:start]); err != nil {
+				return sent, err
+			}
+			if copyCount > 0 && copyStart+copyCount == block.index {
+				copyCount++
+			} else {
+				if err := flushCopy(); err != nil {
+					return sent, err
+				}
+				copyStart, copyCount = block.index, 1
+			}
+			buf = append(buf[:0], buf[start+blockSize:]...)
+			start, valid = 0, false
+			continue
+		}
+
+		if len(buf) <= start+blockSize {
+			break
+		}
+		weak.roll(buf[start], buf[start+blockSize], blockSize)
+		start++
+
+		if start >= deltaMaxLiteral {
+			if err := literal(buf[:start]); err != nil {
+				return sent, err
+			}
+			buf = append(buf[:0], buf[start:]...)
+			start = 0
+		}
+	}
+
+	for len(buf) > 0 {
+		n := min(len(buf), deltaMaxLiteral)
+		if err := literal(buf[:n]); err != nil {
+			return sent, err
+		}
+		buf = buf[n:]
+	}
+	if err := flushCopy(); err != nil {
+		return sent, err
+	}
+	if _, err := out.Write(append([]byte{deltaEnd}, hash.Sum(nil)...)); err != nil {
+		return sent, err
+	}
+	return sent, out.Flush()
+}
+
+// matchBlock looks the window up in signatures, checking candidates with the
+// strong checksum.
+func matchBlock(signatures map[uint32][]deltaBlock, weak uint32, window []byte) (deltaBlock, bool) {
+	candidates := signatures[weak]
+	if len(candidates) == 0 {
+		return deltaBlock{}, false
+	}
+
+	strong := sha256.Sum256(window)
+	for _, block := range candidates {
+		if block.strong == strong {
+			return block, true
+		}
+	}
+	return deltaBlock{}, false
+}
+
+// rollingChecksum is Adler-32, as computed by zlib on the remote side, over
+// a window that can be moved one byte at a time.
+type rollingChecksum struct {
+	a, b uint32
+}
+
+const adlerMod = 65521
+
+func (r *rollingChecksum) reset(window []byte) {
+	r.a, r.b = 1, 0
+	for _, x := range window {
+		r.a = (r.a + uint32(x)) % adlerMod
+		r.b = (r.b + r.a) % adlerMod
+	}
+}
+
+// roll moves the window of n bytes forward by one byte, dropping out and
+// adding in.
+func (r *rollingChecksum) roll(out, in byte, n int) {
+	r.a = (r.a + adlerMod - uint32(out) + uint32(in)) % adlerMod
+	r.b = (r.b + adlerMod - uint32(uint64(n)*uint64(out)%adlerMod) + r.a + adlerMod - 1) % adlerMod
+}
+
+func (r *rollingChecksum) sum() uint32 {
+	return r.b<<16 | r.a
+}
+
+// The remote side of delta transfers.
+const (
+	deltaSign = `import sys, hashlib, zlib
+b = int(sys.argv[2])
+with open(sys.argv[1], 'rb') as f:
+    while True:
+        d = f.read(b)
+        if not d:
+            break
+        print('%08x %s %d' % (zlib.adler32(d) & 0xffffffff, hashlib.sha256(d).hexdigest(), len(d)))
+`
+
+	deltaApply = `import sys, os, hashlib, struct, tempfile
+path, b = sys.argv[1], int(sys.argv[2])
+inp, h = sys.stdin.buffer, hashlib.sha256()
+def read(n):
+    d = inp.read(n)
+    if len(d) != n:
+        sys.exit('Truncated delta')
+    return d
+fd, tmp = tempfile.mkstemp(dir=os.path.dirname(path) or '.', prefix='.' + os.path.basename(path) + '.')
+try:
+    with os.fdopen(fd, 'wb') as out, open(path, 'rb') as src:
+        while True:
+            op = read(1)
+            if op == b'C':
+                i, n = struct.unpack('>QI', read(12))
+                src.seek(i * b)
+                left = n * b
+                while left > 0:
+                    d = src.read(min(left, 1 << 20))
+                    if not d:
+                        break
+                    out.write(d)
+                    h.update(d)
+                    left -= len(d)
+            elif op == b'L':
+                d = read(struct.unpack('>I', read(4))[0])
+                out.write(d)
+                h.update(d)
+            elif op == b'E':
+                if read(32) != h.digest():
+                    sys.exit('Checksum mismatch')
+                break
+            else:
+                sys.exit('Invalid delta')
+        out.flush()
+        os.fsync(out.fileno())
+    os.chmod(tmp, os.stat(path).st_mode & 0o7777)
+    os.rename(tmp, path)
+except BaseException:
+    os.unlink(tmp)
+    raise
+`
+)
+
+// deltaPython returns a command running the python script with remote and the
+// block size as arguments.
+func deltaPython(script, remote string, blockSize int) string {
+	return "python3 -c " + Quote(script) + " " + Quote(remote) + " " + strconv.Itoa(blockSize)
+}
@@ -0,0 +1,147 @@
+package simplessh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/adler32"
+	"math/rand"
+	"testing"
+)
+
+func TestRollingChecksum(t *testing.T) {
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(random)
+	ones := bytes.Repeat([]byte{0xff}, 20000)
+
+	tests := []struct {
+		name string
+		data []byte
+		n    int
+	}{
+		{"one byte", random, 1},
+		{"small", random, 16},
+		{"block", random, 2048},
+		{"zlib NMAX", random, 5552},
+		{"all 0xff", ones, 5553},
+		{"all 0xff large", ones, 16384},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r rollingChecksum
+			r.reset(tt.data[:tt.n])
+			for i := 0; ; i++ {
+				if got, want := r.sum(), adler32.Checksum(tt.data[i:i+tt.n]); got != want {
+					t.Fatalf("sum at %d = %08x, want %08x", i, got, want)
+				}
+				if i+tt.n == len(tt.data) {
+					break
+				}
+				r.roll(tt.data[i], tt.data[i+tt.n], tt.n)
+			}
+		})
+	}
+}
+
+func TestWriteDelta(t *testing.T) {
+	const blockSize = 2048
+	random := func(seed int64, n int) []byte {
+		b := make([]byte, n)
+		rand.New(rand.NewSource(seed)).Read(b)
+		return b
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	old := random(1, 40*blockSize+100)
+
+	tests := []struct {
+		name string
+		old  []byte
+		new  []byte
+		sent int
+	}{
+		{"unchanged", old, old, 100},
+		{"empty", old, nil, 0},
+		{"no remote blocks", nil, old, len(old)},
+		{"prepended", old, join([]byte("header"), old), 6 + 100},
+		{"appended", old[:40*blockSize], join(old[:40*blockSize], []byte("trailer")), 7},
+		{"changed block", old, join(old[:10*blockSize], random(2, blockSize), old[11*blockSize:]), blockSize + 100},
+		{"reordered", old[:4*blockSize], join(old[2*blockSize:4*blockSize], old[:2*blockSize]), 0},
+		{"shorter than a block", old, old[:blockSize-1], blockSize - 1},
+		{"longer literal than one operation", nil, random(3, deltaMaxLiteral+blockSize*3+5), deltaMaxLiteral + blockSize*3 + 5},
+		{"long literal before a match", old[:blockSize], join(random(4, deltaMaxLiteral+5), old[:blockSize]), deltaMaxLiteral + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signatures := map[uint32][]deltaBlock{}
+			for i := 0; i+blockSize <= len(tt.old); i += blockSize {
+				block := tt.old[i : i+blockSize]
+				weak := adler32.Checksum(block)
+				signatures[weak] = append(signatures[weak], deltaBlock{index: uint64(i / blockSize), strong: sha256.Sum256(block)})
+			}
+
+			var delta bytes.Buffer
+			sent, err := writeDelta(&delta, bytes.NewReader(tt.new), blockSize, signatures)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sent != int64(tt.sent) {
+				t.Errorf("sent = %d, want %d", sent, tt.sent)
+			}
+
+			got, err := applyDelta(tt.old, delta.Bytes(), blockSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.new) {
+				t.Errorf("applied delta has %d bytes differing from the %d wanted", len(got), len(tt.new))
+			}
+		})
+	}
+}
+
+// applyDelta rebuilds a file from old and a delta, as deltaApply does on the
+// remote side.
+func applyDelta(old, delta []byte, blockSize int) ([]byte, error) {
+	var out []byte
+	for {
+		if len(delta) == 0 {
+			return nil, errors.New("Truncated delta")
+		}
+		op := delta[0]
+		delta = delta[1:]
+		switch op {
+		case deltaCopy:
+			if len(delta) < 12 {
+				return nil, errors.New("Truncated copy")
+			}
+			start := int(binary.BigEndian.Uint64(delta)) * blockSize
+			end := min(start+int(binary.BigEndian.Uint32(delta[8:]))*blockSize, len(old))
+			if start > end {
+				return nil, errors.New("Copy past the end")
+			}
+			out = append(out, old[start:end]...)
+			delta = delta[12:]
+		case deltaLiteral:
+			if len(delta) < 4 {
+				return nil, errors.New("Truncated literal")
+			}
+			n := int(binary.BigEndian.Uint32(delta))
+			if n > deltaMaxLiteral || len(delta) < 4+n {
+				return nil, errors.New("Invalid literal")
+			}
+			out = append(out, delta[4:4+n]...)
+			delta = delta[4+n:]
+		case deltaEnd:
+			sum := sha256.Sum256(out)
+			if !bytes.Equal(delta, sum[:]) {
+				return nil, errors.New("Checksum mismatch")
+			}
+			return out, nil
+		default:
+			return nil, errors.New("Invalid operation")
+		}
+	}
+}
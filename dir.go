@@ -0,0 +1,107 @@
+package simplessh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// noDirStatus is the exit status of a command run WithDir when the directory
+// can't be entered.
+const noDirStatus = 254
+
+// WithDir runs the command in dir on the remote host. The command isn't run
+// and an error wrapping ErrNoSuchDirectory is returned if dir can't be
+// entered.
+func WithDir(dir string) ExecOption {
+	return func(o *execOptions) {
+		o.dir = dir
+	}
+}
+
+// inDir prefixes cmd with changing to o.dir if set. When the directory can't
+// be entered the returned dirMarker's marker is printed to stderr instead of
+// running cmd.
+func (c *Client) inDir(cmd string, o *execOptions) (string, *dirMarker, error) {
+	if o.dir == "" {
+		return cmd, nil, nil
+	}
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	marker := "simplessh-nodir-" + hex.EncodeToString(nonce)
+
+	dir := c.Quote(o.dir)
+	var remote string
+	switch c.platform {
+	case WindowsCmd:
+		remote = fmt.Sprintf("(cd /d %s 2>nul || (echo %s 1>&2& exit %d)) & %s", dir, marker, noDirStatus, cmd)
+	case WindowsPowerShell:
+		remote = fmt.Sprintf("try { Set-Location -LiteralPath %s -ErrorAction Stop } catch { [Console]::Error.WriteLine('%s'); exit %d }\n%s", dir, marker, noDirStatus, cmd)
+	default:
+		remote = fmt.Sprintf("cd -- %s 2>/dev/null || { echo %s >&2; exit %d; }\n%s", dir, marker, noDirStatus, cmd)
+	}
+	return remote, &dirMarker{marker: []byte(marker)}, nil
+}
+
+// A dirMarker passes output on to w, except for the marker printed in place of
+// running the command when its directory couldn't be entered. The marker can
+// only be the first output.
+type dirMarker struct {
+	w      io.Writer
+	marker []byte
+	buf    []byte
+
+	decided bool
+	found   bool
+}
+
+func (m *dirMarker) wrap(w io.Writer) io.Writer {
+	m.w = w
+	return m
+}
+
+func (m *dirMarker) Write(p []byte) (int, error) {
+	if m.decided {
+		if m.found {
+			// The line ending after the marker.
+			return len(p), nil
+		}
+		return m.w.Write(p)
+	}
+
+	m.buf = append(m.buf, p...)
+	if len(m.buf) < len(m.marker) && bytes.HasPrefix(m.marker, m.buf) {
+		return len(p), nil
+	}
+	m.decided = true
+	if bytes.HasPrefix(m.buf, m.marker) {
+		m.found = true
+		return len(p), nil
+	}
+	return len(p), m.flush()
+}
+
+// flush writes the output held back while it could still have been the
+// marker.
+func (m *dirMarker) flush() error {
+	buf := m.buf
+	m.buf = nil
+	if m.found || len(buf) == 0 {
+		return nil
+	}
+	_, err := m.w.Write(buf)
+	return err
+}
+
+// dirError reports a command run WithDir whose directory couldn't be entered.
+func (c *Client) dirError(err error, o *execOptions, m *dirMarker) error {
+	if m == nil || !m.found {
+		return err
+	}
+	return fmt.Errorf("Couldn't change to %s on %s: %w", o.dir, c.host, ErrNoSuchDirectory)
+}
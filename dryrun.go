@@ -0,0 +1,92 @@
+package simplessh
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Plan collects what Clients in dry-run mode would have done. A single
+// Plan can be shared by many clients to preview a change across a fleet.
+type Plan struct {
+	mu      sync.Mutex
+	actions []PlannedAction
+}
+
+// A PlannedAction is a command or change a Client in dry-run mode skipped.
+type PlannedAction struct {
+	Time time.Time
+	Host string
+	User string
+
+	// Kind is "exec" for commands, "upload" for uploads or the name of the
+	// file helper that would have changed Remote.
+	Kind string
+
+	// Command is set for "exec", Local for uploads.
+	Command string
+	Local   string
+	Remote  string
+}
+
+func (a PlannedAction) String() string {
+	switch {
+	case a.Command != "":
+		return fmt.Sprintf("%s: %s %s", a.Host, a.Kind, a.Command)
+	case a.Local != "":
+		return fmt.Sprintf("%s: %s %s to %s", a.Host, a.Kind, a.Local, a.Remote)
+	}
+	return fmt.Sprintf("%s: %s %s", a.Host, a.Kind, a.Remote)
+}
+
+// WithDryRun makes the connection record the commands Exec and the functions
+// built on it would run, the files Upload would write and the changes the
+// other file helpers would make in plan instead of doing it. Exec returns no
+// output and no error for commands that were recorded. Reading the remote
+// host, such as with Download, isn't affected. Exec middleware still runs, so
+// the plan holds the commands as they'd be sent to the host.
+func WithDryRun(plan *Plan) Option {
+	return func(o *options) {
+		o.plan = plan
+	}
+}
+
+// DryRun reports whether c is recording what it would do instead of doing it.
+func (c *Client) DryRun() bool {
+	return c.plan != nil
+}
+
+// Actions returns the actions recorded so far, in the order they happened.
+func (p *Plan) Actions() []PlannedAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]PlannedAction(nil), p.actions...)
+}
+
+// String returns the actions one per line.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, action := range p.Actions() {
+		b.WriteString(action.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// planned records action if c is in dry-run mode and reports whether it did,
+// in which case the caller must not carry it out.
+func (c *Client) planned(action PlannedAction) bool {
+	if c.plan == nil {
+		return false
+	}
+
+	action.Time, action.Host, action.User = time.Now(), c.host, c.user
+	c.log().Info("Dry run", "kind", action.Kind, "cmd", c.redactedCommand(action.Command), "local", action.Local, "remote", action.Remote)
+
+	c.plan.mu.Lock()
+	c.plan.actions = append(c.plan.actions, action)
+	c.plan.mu.Unlock()
+	return true
+}
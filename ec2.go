@@ -0,0 +1,74 @@
+package simplessh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// An EC2InstanceConnectFunc pushes publicKey, in authorized_keys format, to an
+// instance for osUser through the EC2 Instance Connect API. With the AWS SDK
+// for Go v2 it's typically implemented as:
+//
+//	func(ctx context.Context, instanceID, osUser, publicKey string) error {
+//		_, err := ec2instanceconnect.NewFromConfig(cfg).SendSSHPublicKey(ctx,
+//			&ec2instanceconnect.SendSSHPublicKeyInput{
+//				InstanceId:     aws.String(instanceID),
+//				InstanceOSUser: aws.String(osUser),
+//				SSHPublicKey:   aws.String(publicKey),
+//			})
+//		return err
+//	}
+//
+// This keeps simplessh free of a dependency on the AWS SDK.
+type EC2InstanceConnectFunc func(ctx context.Context, instanceID, osUser, publicKey string) error
+
+// Connect to an EC2 instance without a long-lived key: a key pair is generated
+// in memory, its public key is pushed with send and the connection is
+// authenticated with the private key. The pushed key is only accepted by the
+// instance for 60 seconds. If username is empty simplessh will attempt to get the current user.
+func ConnectWithEC2InstanceConnect(host, username, instanceID string, send EC2InstanceConnectFunc, opts ...Option) (*Client, error) {
+	return ConnectWithEC2InstanceConnectTimeout(host, username, instanceID, send, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithEC2InstanceConnect but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithEC2InstanceConnectTimeout(host, username, instanceID string, send EC2InstanceConnectFunc, timeout time.Duration, opts ...Option) (*Client, error) {
+	target, err := ParseTarget(host)
+	if err != nil {
+		return nil, err
+	}
+	username, err = resolveUsername(username, target)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := newEphemeralSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if err := send(ctx, instanceID, username, publicKey); err != nil {
+		return nil, err
+	}
+
+	authMethod := publicKeys(opts, signer)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// newEphemeralSigner generates an ed25519 key that only lives in memory.
+func newEphemeralSigner() (ssh.Signer, error) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(privKey)
+}
@@ -0,0 +1,133 @@
+package simplessh
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Errors returned by simplessh wrap one of these where it applies, so callers
+// can tell failures apart with errors.Is instead of matching messages.
+var (
+	// ErrAuthFailed means the server rejected every auth method tried.
+	ErrAuthFailed = errors.New("Authentication failed")
+
+	// ErrHostKeyMismatch means the server's host key isn't the expected
+	// one, see HostKeyMismatchError.
+	ErrHostKeyMismatch = errors.New("Host key mismatch")
+
+	// ErrUnknownHost means the server isn't in known_hosts, see
+	// UnknownHostKeyError.
+	ErrUnknownHost = errors.New("Unknown host")
+
+	// ErrConnectTimeout means dialing, the handshake or authentication didn't
+	// finish in time.
+	ErrConnectTimeout = errors.New("Connection timed out")
+
+	// ErrCommandTimeout means a command was stopped because it ran too long,
+	// see TimeoutError.
+	ErrCommandTimeout = errors.New("Command timed out")
+
+	// ErrSFTPUnavailable means the SFTP subsystem couldn't be started.
+	ErrSFTPUnavailable = errors.New("SFTP unavailable")
+
+	// ErrUnsupportedExtension means the SFTP server doesn't support the
+	// extension an operation needs.
+	ErrUnsupportedExtension = errors.New("SFTP extension not supported")
+
+	// ErrTooManySessions means an operation wasn't started because the
+	// connection had as many sessions open as WithMaxSessions allows.
+	ErrTooManySessions = errors.New("Too many sessions")
+
+	// ErrAgentUnavailable means no ssh-agent could be reached.
+	ErrAgentUnavailable = errors.New("ssh-agent unavailable")
+
+	// ErrCircuitOpen means the connection wasn't attempted because the
+	// host's circuit is open, see CircuitOpenError.
+	ErrCircuitOpen = errors.New("Circuit open")
+
+	// ErrCommandDenied means a command wasn't run because a CommandPolicy
+	// rejected it, see PolicyError.
+	ErrCommandDenied = errors.New("Command denied by policy")
+
+	// ErrOutputTruncated means part of a command's output was dropped, see
+	// OutputTruncatedError.
+	ErrOutputTruncated = errors.New("Output truncated")
+
+	// ErrNoSuchDirectory means a command wasn't run because the directory
+	// given with WithDir couldn't be entered.
+	ErrNoSuchDirectory = errors.New("No such directory")
+
+	// ErrBecomeFailed means a command wasn't run because it couldn't be run
+	// as the user given with WithBecome or WithExecBecome.
+	ErrBecomeFailed = errors.New("Privilege escalation failed")
+)
+
+// An ExitError is returned when a command ran but didn't exit successfully.
+// It wraps the *ssh.ExitError reported by the session.
+type ExitError struct {
+	Cmd string
+
+	// Status is the command's exit status, -1 if it was killed by a signal.
+	Status int
+
+	// Signal is the name of the signal that killed the command, such as
+	// "KILL", if any.
+	Signal string
+
+	err *ssh.ExitError
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("Command %q was killed by signal %s", e.Cmd, e.Signal)
+	}
+	return fmt.Sprintf("Command %q exited with status %d", e.Cmd, e.Status)
+}
+
+func (e *ExitError) Unwrap() error {
+	if e.err == nil {
+		return nil
+	}
+	return e.err
+}
+
+// newExitError wraps err in an *ExitError if it reports a command's exit
+// status and returns it unchanged otherwise.
+func newExitError(cmd string, err error) error {
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	e := &ExitError{Cmd: cmd, Status: exitErr.ExitStatus(), Signal: exitErr.Signal(), err: exitErr}
+	if e.Signal != "" {
+		e.Status = -1
+	}
+	return e
+}
+
+func (e *HostKeyMismatchError) Is(target error) bool {
+	return target == ErrHostKeyMismatch
+}
+
+func (e *UnknownHostKeyError) Is(target error) bool {
+	return target == ErrUnknownHost
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrCommandTimeout
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrCommandDenied
+}
+
+func (e *OutputTruncatedError) Is(target error) bool {
+	return target == ErrOutputTruncated
+}
@@ -0,0 +1,299 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultKillGrace is how long a command that timed out gets to exit after
+// SIGTERM before it's sent SIGKILL.
+const DefaultKillGrace = 5 * time.Second
+
+// An ExecOption configures how a command is run by Exec and the functions
+// built on it.
+type ExecOption func(*execOptions)
+
+type execOptions struct {
+	timeout   time.Duration
+	killGrace time.Duration
+	retry     RetryPolicy
+	ctx       context.Context
+	maxOutput int
+	keepTail  bool
+
+	interpreter string
+	dir         string
+	stdin       io.Reader
+	readOnly    bool
+	signals     <-chan ssh.Signal
+	pty         *PTY
+	become      *Become
+	becomeSet   bool
+}
+
+func newExecOptions(opts []ExecOption) *execOptions {
+	o := &execOptions{killGrace: DefaultKillGrace}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// withStdin feeds r to the command's stdin.
+func withStdin(r io.Reader) ExecOption {
+	return func(o *execOptions) {
+		o.stdin = r
+	}
+}
+
+// readOnly marks commands that don't change the host, which run even in
+// dry-run mode.
+func readOnly(o *execOptions) {
+	o.readOnly = true
+}
+
+// WithCommandTimeout stops the command if it hasn't finished after timeout:
+// it's sent SIGTERM, then SIGKILL if it's still running after the kill grace
+// period, and the session is closed. The command's output up to that point is
+// returned along with a *TimeoutError. Servers that ignore signal requests,
+// such as OpenSSH before 8.1, only see the session being closed, which may
+// leave the remote process running.
+func WithCommandTimeout(timeout time.Duration) ExecOption {
+	return func(o *execOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithSignals delivers the signals received on signals to the command while
+// it runs, so callers can interrupt it gracefully, for example by relaying
+// os.Interrupt as ssh.SIGINT. Closing the channel stops the delivery but not
+// the command. Servers that ignore signal requests, such as OpenSSH before 8.1,
+// drop them.
+func WithSignals(signals <-chan ssh.Signal) ExecOption {
+	return func(o *execOptions) {
+		o.signals = signals
+	}
+}
+
+// WithKillGrace sets how long a command that timed out gets to exit after
+// SIGTERM before it's sent SIGKILL, DefaultKillGrace if not set.
+func WithKillGrace(grace time.Duration) ExecOption {
+	return func(o *execOptions) {
+		o.killGrace = grace
+	}
+}
+
+// A TimeoutError is returned when a command is stopped because it ran longer
+// than WithCommandTimeout allows.
+type TimeoutError struct {
+	Cmd     string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("Command %q timed out after %v", e.Cmd, e.Timeout)
+}
+
+// exec runs cmd in a new session, writing its output to stdout and stderr.
+func (c *Client) exec(cmd string, stdout, stderr io.Writer, o *execOptions) (err error) {
+	logger := c.log().With("cmd", c.redactedCommand(cmd))
+	logger.Debug("Running command")
+	start := time.Now()
+
+	ctx := o.context()
+	_, span := c.startSpan(ctx, "ssh.exec", attribute.String("ssh.command.sha256", commandHash(cmd)))
+	var written atomic.Int64
+	var become *becomeSession
+	var noDir *dirMarker
+	defer func() {
+		if become != nil {
+			err = become.result(err)
+		}
+		err = c.dirError(err, o, noDir)
+		logCommand(logger, start, err)
+		c.recorder().CommandFinished(c.host, time.Since(start), err)
+		c.audit(cmd, start, err)
+
+		span.SetAttributes(attribute.Int64("ssh.bytes", written.Load()))
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) {
+			span.SetAttributes(attribute.Int("ssh.exit_status", exitErr.Status))
+		}
+		endSpan(span, err)
+	}()
+
+	session, release, err := c.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer session.Close()
+	defer c.openChannel("session")()
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	remote, noDir, err := c.inDir(cmd, o)
+	if err != nil {
+		return err
+	}
+	pty := o.pty
+	if b := o.becomeFor(c); b != nil {
+		if become, err = c.newBecomeSession(b); err != nil {
+			return err
+		}
+		if remote, err = become.command(remote); err != nil {
+			return err
+		}
+		if become.needPTY && pty == nil {
+			pty = NewPTY(80, 24)
+		}
+	}
+
+	if noDir != nil {
+		// A PTY merges stderr into stdout.
+		if pty != nil {
+			stdout = noDir.wrap(stdout)
+		} else {
+			stderr = noDir.wrap(stderr)
+		}
+		defer noDir.flush()
+	}
+
+	if become != nil {
+		if stdout, stderr, err = become.attach(session, o.stdin, stdout, stderr, pty != nil); err != nil {
+			return err
+		}
+	} else {
+		session.Stdin = o.stdin
+	}
+
+	session.Stdout = &countingWriter{w: stdout, n: &written}
+	session.Stderr = &countingWriter{w: stderr, n: &written}
+
+	if pty != nil {
+		detach, err := pty.request(session)
+		if err != nil {
+			return err
+		}
+		defer detach()
+	}
+
+	if o.timeout <= 0 && ctx.Done() == nil && o.signals == nil {
+		return newExitError(cmd, session.Run(remote))
+	}
+
+	if err := session.Start(remote); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if o.timeout > 0 {
+		timer := time.NewTimer(o.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	signals := o.signals
+	var stopErr error
+	for stopErr == nil {
+		select {
+		case err := <-done:
+			return newExitError(cmd, err)
+		case signal, ok := <-signals:
+			if !ok {
+				signals = nil
+				continue
+			}
+			logger.Debug("Sending signal", "signal", signal)
+			if err := session.Signal(signal); err != nil {
+				logger.Warn("Sending signal failed", "signal", signal, "error", err)
+			}
+		case <-timeout:
+			stopErr = &TimeoutError{Cmd: cmd, Timeout: o.timeout}
+		case <-ctx.Done():
+			stopErr = ctx.Err()
+		}
+	}
+
+	for _, signal := range []ssh.Signal{ssh.SIGTERM, ssh.SIGKILL} {
+		session.Signal(signal)
+		select {
+		case <-done:
+			return stopErr
+		case <-time.After(o.killGrace):
+		}
+	}
+
+	// The command ignored the signals, or the server did. Closing the session
+	// ends the output copying, so none of it is written after we return.
+	session.Close()
+	<-done
+	return stopErr
+}
+
+// countingWriter counts the bytes written through it into n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// logCommand logs how a command finished.
+func logCommand(logger *slog.Logger, start time.Time, err error) {
+	logger = logger.With("duration", time.Since(start))
+
+	var exitErr *ExitError
+	switch {
+	case err == nil:
+		logger.Info("Command finished", "exit_status", 0)
+	case errors.As(err, &exitErr) && exitErr.Signal != "":
+		logger.Info("Command finished", "signal", exitErr.Signal)
+	case errors.As(err, &exitErr):
+		logger.Info("Command finished", "exit_status", exitErr.Status)
+	default:
+		logger.Warn("Command failed", "error", err)
+	}
+}
+
+// combinedOutput returns a writer for both stdout and stderr, which the
+// session writes to from separate goroutines.
+func (o *execOptions) combinedOutput() (*outputBuffer, io.Writer) {
+	buf := o.newOutputBuffer()
+	return buf, &syncWriter{w: buf}
+}
+
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.w.Write(p)
+}
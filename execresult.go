@@ -0,0 +1,53 @@
+package simplessh
+
+import (
+	"errors"
+	"time"
+)
+
+// An ExecResult is the outcome of a command run by ExecFull.
+type ExecResult struct {
+	Host   string
+	Cmd    string
+	Stdout []byte
+	Stderr []byte
+
+	// ExitCode is the command's exit status, -1 if it was killed by a signal
+	// or didn't get to run.
+	ExitCode int
+
+	// Started and Finished span all of the attempts when retrying.
+	Started  time.Time
+	Finished time.Time
+	Duration time.Duration
+}
+
+// ExecFull runs cmd like ExecWithOutputStreams and returns everything known
+// about the run in an ExecResult, which is never nil. The error is the same
+// as ExecWithOutputStreams's, an *ExitError if cmd exited with a non-zero
+// status.
+func (c *Client) ExecFull(cmd string, opts ...ExecOption) (*ExecResult, error) {
+	result := &ExecResult{Host: c.host, Cmd: cmd, Started: time.Now()}
+
+	stdout, stderr, err := c.ExecWithOutputStreams(cmd, opts...)
+	result.Finished = time.Now()
+	result.Duration = result.Finished.Sub(result.Started)
+	result.Stdout, result.Stderr = stdout, stderr
+
+	var exitErr *ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.Status
+	case err != nil && !onlyTruncated(err):
+		result.ExitCode = -1
+	}
+	return result, err
+}
+
+// onlyTruncated reports whether err only says that the output was truncated,
+// meaning the command succeeded.
+func onlyTruncated(err error) bool {
+	var truncated *OutputTruncatedError
+	joined, ok := err.(interface{ Unwrap() []error })
+	return ok && len(joined.Unwrap()) == 1 && errors.As(err, &truncated)
+}
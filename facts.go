@@ -0,0 +1,136 @@
+package simplessh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Facts describe the remote host.
+type Facts struct {
+	// OS is the lower-cased kernel name, such as "linux", "darwin" or
+	// "freebsd", or "windows".
+	OS string
+
+	// Distro and Version identify the distribution, for example "ubuntu"
+	// and "24.04" from /etc/os-release, "macos" and "14.5" or the Windows
+	// edition and version.
+	Distro  string
+	Version string
+
+	// Arch is the machine's architecture as the host names it, such as
+	// "x86_64", "aarch64" or "AMD64".
+	Arch string
+
+	// Kernel is the kernel release or, on Windows, the build number.
+	Kernel string
+
+	Hostname string
+	CPUs     int
+
+	// Memory is the total physical memory in bytes.
+	Memory uint64
+}
+
+// factsScript prints the facts of Unix hosts as key=value lines.
+const factsScript = `echo "os=$(uname -s)"
+echo "arch=$(uname -m)"
+echo "kernel=$(uname -r)"
+echo "hostname=$(hostname 2>/dev/null || uname -n)"
+echo "cpus=$(nproc 2>/dev/null || getconf _NPROCESSORS_ONLN 2>/dev/null || sysctl -n hw.ncpu 2>/dev/null)"
+if [ -r /proc/meminfo ]; then
+	echo "memory_kb=$(awk '/^MemTotal:/ { print $2 }' /proc/meminfo)"
+else
+	echo "memory=$(sysctl -n hw.memsize 2>/dev/null || sysctl -n hw.physmem 2>/dev/null)"
+fi
+if [ -r /etc/os-release ]; then
+	(. /etc/os-release; echo "distro=$ID"; echo "version=$VERSION_ID")
+elif command -v sw_vers >/dev/null 2>&1; then
+	echo "distro=macos"; echo "version=$(sw_vers -productVersion)"
+fi`
+
+// windowsFactsScript is the PowerShell equivalent of factsScript. It has no
+// double quotes so it can be passed to powershell -Command from cmd.exe.
+const windowsFactsScript = `$os = Get-CimInstance Win32_OperatingSystem; ` +
+	`$cs = Get-CimInstance Win32_ComputerSystem; ` +
+	`'os=windows'; ` +
+	`'distro=' + $os.Caption; ` +
+	`'version=' + $os.Version; ` +
+	`'arch=' + $env:PROCESSOR_ARCHITECTURE; ` +
+	`'kernel=' + $os.BuildNumber; ` +
+	`'hostname=' + $env:COMPUTERNAME; ` +
+	`'cpus=' + $cs.NumberOfLogicalProcessors; ` +
+	`'memory=' + $cs.TotalPhysicalMemory`
+
+// Facts probes the remote host for its OS, distribution, architecture,
+// kernel, hostname, CPU count and memory. The probe runs once per Client,
+// later calls return the same facts. Facts that couldn't be found are left
+// empty.
+func (c *Client) Facts() (Facts, error) {
+	c.factsMu.Lock()
+	defer c.factsMu.Unlock()
+
+	if c.facts != nil {
+		return *c.facts, nil
+	}
+
+	var cmd string
+	switch c.platform {
+	case WindowsCmd:
+		cmd = `powershell -NoProfile -NonInteractive -Command "` + windowsFactsScript + `"`
+	case WindowsPowerShell:
+		cmd = windowsFactsScript
+	default:
+		cmd = factsScript
+	}
+
+	// The probe only reads, so it runs in dry-run mode too.
+	stdout, _, err := c.ExecWithOutputStreams(cmd, readOnly)
+	if err != nil {
+		return Facts{}, fmt.Errorf("Couldn't probe the host's facts: %w", err)
+	}
+
+	facts := parseFacts(stdout)
+	c.facts = &facts
+	return facts, nil
+}
+
+func parseFacts(output []byte) Facts {
+	var facts Facts
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch key {
+		case "os":
+			facts.OS = strings.ToLower(value)
+		case "distro":
+			facts.Distro = value
+		case "version":
+			facts.Version = value
+		case "arch":
+			facts.Arch = value
+		case "kernel":
+			facts.Kernel = value
+		case "hostname":
+			facts.Hostname = value
+		case "cpus":
+			facts.CPUs, _ = strconv.Atoi(value)
+		case "memory":
+			facts.Memory, _ = strconv.ParseUint(value, 10, 64)
+		case "memory_kb":
+			if kb, err := strconv.ParseUint(value, 10, 64); err == nil {
+				facts.Memory = kb * 1024
+			}
+		}
+	}
+
+	return facts
+}
@@ -0,0 +1,207 @@
+package simplessh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/norman-abramovitz/simplessh/internal/lineedit"
+)
+
+// A remoteFile is what fileState found at a path on the remote host.
+type remoteFile struct {
+	exists bool
+	sha256 string
+	mode   string
+	owner  string
+	group  string
+}
+
+// fileState looks up the checksum, permissions and owner of path with
+// commands, so it works as the user given with WithBecome.
+func (c *Client) fileState(path string) (remoteFile, error) {
+	if c.platform.Windows() {
+		return remoteFile{}, errors.New("File helpers aren't supported on Windows hosts")
+	}
+
+	output, err := c.fileExec(`f=`+Quote(path)+`
+[ -e "$f" ] || { echo missing; exit 0; }
+sum=$( { sha256sum "$f" 2>/dev/null || shasum -a 256 "$f"; } | cut -d ' ' -f 1) || exit 1
+meta=$(stat -c '%a %U %G' "$f" 2>/dev/null || stat -f '%Lp %Su %Sg' "$f") || exit 1
+echo "$sum $meta"`, nil)
+	if err != nil {
+		return remoteFile{}, fmt.Errorf("Couldn't check %s: %w", path, err)
+	}
+
+	fields := strings.Fields(string(output))
+	switch {
+	case len(fields) == 1 && fields[0] == "missing":
+		return remoteFile{}, nil
+	case len(fields) != 4:
+		return remoteFile{}, fmt.Errorf("Couldn't check %s: unexpected output %q", path, output)
+	}
+	return remoteFile{exists: true, sha256: fields[0], mode: fields[1], owner: fields[2], group: fields[3]}, nil
+}
+
+// EnsureFile makes the remote file at path have content, mode and owner,
+// writing it only when it doesn't already, and reports whether it changed
+// anything. The content is replaced atomically by renaming a temporary file
+// next to path. owner is "user" or "user:group". If it's empty the owner
+// isn't checked and a rewritten file belongs to the user writing it.
+// EnsureFile runs commands rather than SFTP, so it applies WithBecome and
+// needs a POSIX shell on the remote host. In dry-run mode it records the
+// change it would make and reports it as made.
+func (c *Client) EnsureFile(path string, content []byte, mode os.FileMode, owner string) (bool, error) {
+	current, err := c.fileState(path)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(content)
+	sameContent := current.exists && current.sha256 == hex.EncodeToString(sum[:])
+	if sameContent && current.hasMode(mode) && current.hasOwner(owner) {
+		return false, nil
+	}
+	if c.planned(PlannedAction{Kind: "ensure-file", Remote: path}) {
+		return true, nil
+	}
+
+	setMeta := chmod(mode)
+	if owner != "" {
+		setMeta += " && chown " + Quote(owner) + ` "$t"`
+	}
+
+	if sameContent {
+		// Only the metadata is fixed, on path itself.
+		_, err = c.fileExec(`t=`+Quote(path)+`
+`+setMeta, nil)
+	} else {
+		// The temporary file is created next to path so the rename stays on
+		// one file system.
+		_, err = c.writeFile(path, bytes.NewReader(content), setMeta)
+	}
+	if err != nil {
+		return false, fmt.Errorf("Couldn't write %s: %w", path, err)
+	}
+
+	c.log().Info("File changed", "remote", path)
+	return true, nil
+}
+
+// writeFile atomically replaces path with what's read from content, running
+// setMeta on the temporary file in $t before it's renamed.
+func (c *Client) writeFile(path string, content *bytes.Reader, setMeta string) ([]byte, error) {
+	return c.fileExec(`f=`+Quote(path)+`
+t=$(mktemp "$f.XXXXXX") || exit 1
+{ cat > "$t" && `+setMeta+` && mv -f "$t" "$f"; } || { rm -f "$t"; exit 1; }`, content)
+}
+
+// fileExec runs a file helper's script, feeding it stdin, and returns its
+// stdout. The helpers record their own dry-run actions, so the script isn't.
+func (c *Client) fileExec(script string, stdin io.Reader) ([]byte, error) {
+	opts := []ExecOption{readOnly}
+	if stdin != nil {
+		opts = append(opts, withStdin(stdin))
+	}
+
+	stdout, stderr, err := c.ExecWithOutputStreams(script, opts...)
+	if err != nil && len(stderr) > 0 {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(stderr)))
+	}
+	return stdout, err
+}
+
+// chmod returns a command setting the permissions of $t to mode.
+func chmod(mode os.FileMode) string {
+	return fmt.Sprintf(`chmod %04o "$t"`, mode.Perm())
+}
+
+func (f remoteFile) hasMode(mode os.FileMode) bool {
+	return f.mode == fmt.Sprintf("%o", mode.Perm())
+}
+
+func (f remoteFile) hasOwner(owner string) bool {
+	if owner == "" {
+		return true
+	}
+	user, group, hasGroup := strings.Cut(owner, ":")
+	return f.owner == user && (!hasGroup || f.group == group)
+}
+
+// UploadTemplate renders tmpl with data and atomically writes the result to
+// remotePath with mode, as EnsureFile does but without checking what's there
+// first.
+func (c *Client) UploadTemplate(tmpl *template.Template, data any, remotePath string, mode os.FileMode) error {
+	if c.platform.Windows() {
+		return errors.New("File helpers aren't supported on Windows hosts")
+	}
+
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return fmt.Errorf("Couldn't render %s: %w", tmpl.Name(), err)
+	}
+	if c.planned(PlannedAction{Kind: "upload-template", Local: tmpl.Name(), Remote: remotePath}) {
+		return nil
+	}
+
+	if _, err := c.writeFile(remotePath, bytes.NewReader(content.Bytes()), chmod(mode)); err != nil {
+		return fmt.Errorf("Couldn't write %s: %w", remotePath, err)
+	}
+
+	c.log().Info("Template uploaded", "template", tmpl.Name(), "remote", remotePath, "bytes", content.Len())
+	return nil
+}
+
+// LineInFile edits the remote file at path line by line. With ensurePresent
+// every line matching match is replaced with line, and line is appended if
+// none match. Without it the matching lines are removed. The file is written
+// atomically only if that changes it, keeping its mode and, when allowed,
+// its owner, and the original is kept next to it with a ".bak-" and time
+// suffix. It reports whether the file changed. Like EnsureFile it runs
+// commands, so it applies WithBecome.
+func (c *Client) LineInFile(path, match, line string, ensurePresent bool) (bool, error) {
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := c.fileState(path)
+	if err != nil {
+		return false, err
+	}
+	if !current.exists {
+		return false, fmt.Errorf("Couldn't edit %s: %w", path, os.ErrNotExist)
+	}
+	content, err := c.fileExec(`cat -- `+Quote(path), nil)
+	if err != nil {
+		return false, fmt.Errorf("Couldn't read %s: %w", path, err)
+	}
+
+	edited := lineedit.Edit(content, re, line, ensurePresent)
+	if bytes.Equal(edited, content) {
+		return false, nil
+	}
+	if c.planned(PlannedAction{Kind: "line-in-file", Remote: path}) {
+		return true, nil
+	}
+
+	// Only root can give the file to another user, so restoring the owner
+	// is best effort.
+	backup := path + ".bak-" + time.Now().Format("20060102T150405.000")
+	setMeta := `cp -p -- "$f" ` + Quote(backup) + ` && chmod ` + current.mode + ` "$t" && { chown ` +
+		Quote(current.owner+":"+current.group) + ` "$t" 2>/dev/null || true; }`
+	if _, err := c.writeFile(path, bytes.NewReader(edited), setMeta); err != nil {
+		return false, fmt.Errorf("Couldn't write %s: %w", path, err)
+	}
+
+	c.log().Info("File changed", "remote", path, "backup", backup)
+	return true, nil
+}
@@ -0,0 +1,262 @@
+package simplessh
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A Forwarder tunnels connections accepted on a local listener through the SSH
+// connection, either to a fixed remote address (ForwardLocal) or to wherever a
+// SOCKS client asks to go (SOCKS5).
+type Forwarder struct {
+	client   *Client
+	listener net.Listener
+	connect  func(local net.Conn) (net.Conn, error)
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+
+	active atomic.Int64
+	total  atomic.Int64
+}
+
+// Dial connects to addr from the remote host through the SSH connection. The
+// network must be "tcp", "tcp4", "tcp6" or "unix". The returned net.Conn can
+// be handed to database drivers and other clients that accept one.
+func (c *Client) Dial(network, addr string) (net.Conn, error) {
+	return c.SSHClient.Dial(network, addr)
+}
+
+// DialContext is like Dial but gives up when ctx is done before the remote
+// host has opened the connection.
+func (c *Client) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return c.SSHClient.DialContext(ctx, network, addr)
+}
+
+// HTTPTransport returns an *http.Transport that opens its connections through
+// the SSH connection, so services listening on the remote host's loopback
+// interface or private network can be called with net/http. Proxy settings
+// from the environment are ignored since they'd apply to the local network.
+func (c *Client) HTTPTransport() *http.Transport {
+	return &http.Transport{
+		DialContext:           c.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// GRPCDialer returns a dial function for grpc.WithContextDialer that reaches
+// gRPC servers through the SSH connection. Addresses of the form
+// "unix:/path/to.sock" dial a Unix socket on the remote host, anything else is
+// treated as host:port. Targets should use the "passthrough:///" scheme so
+// names are resolved by the remote host rather than locally.
+func (c *Client) GRPCDialer() func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			return c.DialContext(ctx, "unix", path)
+		}
+		return c.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// StdioForward connects to remoteAddr from the remote host and copies in to it
+// and its output to out until the remote end closes the connection, the
+// equivalent of ssh -W. Passing os.Stdin and os.Stdout lets a program built on
+// simplessh act as a ProxyCommand for other SSH clients.
+func (c *Client) StdioForward(remoteAddr string, in io.Reader, out io.Writer) error {
+	conn, err := c.Dial("tcp", remoteAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, in)
+		// Signal EOF to the remote end but keep reading its output.
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+
+	_, err = io.Copy(out, conn)
+	return err
+}
+
+// Listen on localAddr and forward every accepted connection to remoteAddr as
+// seen from the remote host. Use "127.0.0.1:0" as localAddr to pick a free
+// port and Addr to find out which one was chosen. The Forwarder must be closed
+// when it's no longer needed.
+func (c *Client) ForwardLocal(localAddr, remoteAddr string) (*Forwarder, error) {
+	return newForwarder(c, localAddr, func(net.Conn) (net.Conn, error) {
+		return c.Dial("tcp", remoteAddr)
+	})
+}
+
+// newForwarder listens on localAddr and hands every accepted connection to
+// connect, which returns the remote end to pipe it to.
+func newForwarder(c *Client, localAddr string, connect func(net.Conn) (net.Conn, error)) (*Forwarder, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Forwarder{
+		client:   c,
+		listener: listener,
+		connect:  connect,
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	f.wg.Add(1)
+	go f.serve()
+
+	return f, nil
+}
+
+// Addr returns the local address the Forwarder is listening on.
+func (f *Forwarder) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// ActiveConns returns the number of connections currently being forwarded.
+func (f *Forwarder) ActiveConns() int64 {
+	return f.active.Load()
+}
+
+// TotalConns returns the number of connections forwarded since the Forwarder
+// was started, including those that are still active.
+func (f *Forwarder) TotalConns() int64 {
+	return f.total.Load()
+}
+
+// Close stops accepting new connections, closes every active one and waits
+// for the forwarding goroutines to finish. The SSH connection is left open.
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.listener.Close()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+func (f *Forwarder) serve() {
+	defer f.wg.Done()
+
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		if !f.track(local) {
+			local.Close()
+			return
+		}
+
+		f.wg.Add(1)
+		go f.forward(local)
+	}
+}
+
+func (f *Forwarder) forward(local net.Conn) {
+	defer f.wg.Done()
+	defer f.untrack(local)
+
+	_, span := f.client.startSpan(context.Background(), "ssh.forward",
+		attribute.String("client.address", local.RemoteAddr().String()),
+		attribute.String("ssh.listen_address", f.listener.Addr().String()))
+
+	remote, err := f.connect(local)
+	if err != nil {
+		endSpan(span, err)
+		local.Close()
+		return
+	}
+	span.SetAttributes(attribute.String("ssh.remote_address", remote.RemoteAddr().String()))
+	if !f.track(remote) {
+		endSpan(span, nil)
+		remote.Close()
+		local.Close()
+		return
+	}
+	defer f.untrack(remote)
+
+	f.active.Add(1)
+	f.total.Add(1)
+	defer f.active.Add(-1)
+	defer f.client.openChannel("forward")()
+
+	sent, received := pipe(local, remote)
+	span.SetAttributes(attribute.Int64("ssh.bytes_sent", sent), attribute.Int64("ssh.bytes_received", received))
+	endSpan(span, nil)
+}
+
+// track registers conn so Close can tear it down. It returns false if the
+// Forwarder has already been closed.
+func (f *Forwarder) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *Forwarder) untrack(conn net.Conn) {
+	f.mu.Lock()
+	delete(f.conns, conn)
+	f.mu.Unlock()
+}
+
+// pipe copies data in both directions until either side is done and then
+// closes both connections. It returns the number of bytes copied from a to b
+// and from b to a.
+func pipe(a, b net.Conn) (aToB, bToA int64) {
+	var once sync.Once
+	closeBoth := func() {
+		a.Close()
+		b.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		bToA, _ = io.Copy(a, b)
+		once.Do(closeBoth)
+	}()
+	go func() {
+		defer wg.Done()
+		aToB, _ = io.Copy(b, a)
+		once.Do(closeBoth)
+	}()
+	wg.Wait()
+
+	return aToB, bToA
+}
@@ -0,0 +1,149 @@
+package simplessh
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// connectionAttemptDelay is how long a connection attempt gets before the
+// next address is tried alongside it, as recommended by RFC 8305.
+const connectionAttemptDelay = 250 * time.Millisecond
+
+// dialHappyEyeballs returns a DialFunc dialing with d that, when the host
+// resolves to several addresses, tries them alternating between IPv6 and IPv4
+// and starting the next attempt whenever the previous one fails or hasn't
+// connected within connectionAttemptDelay, so an unreachable address family
+// doesn't hold up the connection. The first connection made wins.
+func dialHappyEyeballs(d *net.Dialer) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var lookup string
+		switch network {
+		case "tcp":
+			lookup = "ip"
+		case "tcp4":
+			lookup = "ip4"
+		case "tcp6":
+			lookup = "ip6"
+		default:
+			return d.DialContext(ctx, network, addr)
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return d.DialContext(ctx, network, addr)
+		}
+		// Addresses, including IPv6 ones with a zone, are dialed as they are.
+		if _, err := netip.ParseAddr(host); err == nil {
+			return d.DialContext(ctx, network, addr)
+		}
+
+		resolver := d.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		ips, err := resolver.LookupIP(ctx, lookup, host)
+		if err != nil {
+			return nil, err
+		}
+		addrs := interleaveFamilies(ips)
+		switch len(addrs) {
+		case 0:
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		case 1:
+			return d.DialContext(ctx, network, net.JoinHostPort(addrs[0].String(), port))
+		}
+
+		return raceDial(ctx, d, network, addrs, port)
+	}
+}
+
+// interleaveFamilies orders ips alternating between IPv6 and IPv4, starting
+// with IPv6 and otherwise keeping the resolver's order.
+func interleaveFamilies(ips []net.IP) []net.IP {
+	var v6, v4 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	ordered := make([]net.IP, 0, len(ips))
+	for len(v6) > 0 || len(v4) > 0 {
+		if len(v6) > 0 {
+			ordered = append(ordered, v6[0])
+			v6 = v6[1:]
+		}
+		if len(v4) > 0 {
+			ordered = append(ordered, v4[0])
+			v4 = v4[1:]
+		}
+	}
+	return ordered
+}
+
+// raceDial dials addrs in order with staggered starts and returns the first
+// connection made, closing any made after it. If all attempts fail the error
+// of the first one is returned.
+func raceDial(ctx context.Context, d *net.Dialer, network string, addrs []net.IP, port string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result)
+	var pending, next int
+	var delay <-chan time.Time
+
+	start := func() {
+		addr := net.JoinHostPort(addrs[next].String(), port)
+		next++
+		pending++
+		go func() {
+			conn, err := d.DialContext(ctx, network, addr)
+			results <- result{conn, err}
+		}()
+
+		delay = nil
+		if next < len(addrs) {
+			delay = time.After(connectionAttemptDelay)
+		}
+	}
+
+	start()
+	var firstErr error
+	for {
+		select {
+		case <-delay:
+			start()
+
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// The other attempts end when ctx is canceled.
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(addrs) {
+				start()
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package simplessh
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	ips := func(addrs ...string) []net.IP {
+		var ips []net.IP
+		for _, addr := range addrs {
+			ips = append(ips, net.ParseIP(addr))
+		}
+		return ips
+	}
+
+	tests := []struct {
+		name string
+		ips  []net.IP
+		want []net.IP
+	}{
+		{"none", nil, ips()},
+		{"IPv4 only", ips("192.0.2.1", "192.0.2.2"), ips("192.0.2.1", "192.0.2.2")},
+		{"IPv6 only", ips("2001:db8::1", "2001:db8::2"), ips("2001:db8::1", "2001:db8::2")},
+		{"IPv4 first", ips("192.0.2.1", "192.0.2.2", "2001:db8::1"), ips("2001:db8::1", "192.0.2.1", "192.0.2.2")},
+		{
+			"more IPv6",
+			ips("2001:db8::1", "2001:db8::2", "2001:db8::3", "192.0.2.1"),
+			ips("2001:db8::1", "192.0.2.1", "2001:db8::2", "2001:db8::3"),
+		},
+		{
+			"alternating",
+			ips("192.0.2.1", "2001:db8::1", "192.0.2.2", "2001:db8::2"),
+			ips("2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2"),
+		},
+		{"IPv4-mapped", ips("::ffff:192.0.2.1", "2001:db8::1"), ips("2001:db8::1", "::ffff:192.0.2.1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interleaveFamilies(tt.ips)
+			if !slices.EqualFunc(got, tt.want, net.IP.Equal) {
+				t.Errorf("interleaveFamilies(%v) = %v, want %v", tt.ips, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package simplessh
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A ConnectionInfo describes a connection to the lifecycle hooks.
+type ConnectionInfo struct {
+	Host string
+	User string
+
+	// The rest is only known once connected. Algorithms is left empty on
+	// connections made with WithTrace.
+	RemoteAddr    net.Addr
+	ServerVersion string
+	ClientVersion string
+	SessionID     []byte
+	Algorithms    ssh.NegotiatedAlgorithms
+}
+
+// Hooks are called as connections are established and lost, so applications
+// can emit their own events. Any of them may be nil. Like the methods of a
+// MetricsRecorder they may be called concurrently and shouldn't block.
+type Hooks struct {
+	// OnConnect is called once connecting succeeded.
+	OnConnect func(info ConnectionInfo)
+
+	// OnDisconnect is called when an established connection is closed,
+	// by Client.Close or because it was lost.
+	OnDisconnect func(info ConnectionInfo)
+
+	// OnError is called when connecting failed, after any retries.
+	OnError func(info ConnectionInfo, err error)
+}
+
+var (
+	globalHooksMu sync.Mutex
+	globalHooks   []Hooks
+)
+
+// RegisterHooks has hooks called for every connection made from now on, before
+// the hooks given with WithHooks.
+func RegisterHooks(hooks Hooks) {
+	globalHooksMu.Lock()
+	defer globalHooksMu.Unlock()
+
+	globalHooks = append(globalHooks, hooks)
+}
+
+// WithHooks has hooks called for the connection. It may be given more than
+// once.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
+
+// allHooks returns the global hooks followed by those of the options.
+func (o *options) allHooks() []Hooks {
+	globalHooksMu.Lock()
+	defer globalHooksMu.Unlock()
+
+	return append(append([]Hooks(nil), globalHooks...), o.hooks...)
+}
+
+// connectFailed calls the OnError hooks.
+func (o *options) connectFailed(host, username string, err error) {
+	info := ConnectionInfo{Host: host, User: username}
+	for _, hooks := range o.allHooks() {
+		if hooks.OnError != nil {
+			hooks.OnError(info, err)
+		}
+	}
+}
+
+// connected calls the OnConnect hooks and has the OnDisconnect ones called
+// when the connection of c ends.
+func (o *options) connected(c *Client) {
+	all := o.allHooks()
+	if len(all) == 0 {
+		return
+	}
+
+	info := c.connectionInfo()
+	for _, hooks := range all {
+		if hooks.OnConnect != nil {
+			hooks.OnConnect(info)
+		}
+	}
+
+	go func() {
+		c.SSHClient.Wait()
+		for _, hooks := range all {
+			if hooks.OnDisconnect != nil {
+				hooks.OnDisconnect(info)
+			}
+		}
+	}()
+}
+
+func (c *Client) connectionInfo() ConnectionInfo {
+	info := ConnectionInfo{
+		Host:          c.host,
+		User:          c.user,
+		RemoteAddr:    c.SSHClient.RemoteAddr(),
+		ServerVersion: string(c.SSHClient.ServerVersion()),
+		ClientVersion: string(c.SSHClient.ClientVersion()),
+		SessionID:     c.SSHClient.SessionID(),
+	}
+	if algorithmsConn, ok := c.SSHClient.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		info.Algorithms = algorithmsConn.Algorithms()
+	}
+	return info
+}
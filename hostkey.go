@@ -0,0 +1,115 @@
+package simplessh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A HostKeyMismatchError is returned when the server presents a host key that
+// doesn't match the expected one.
+type HostKeyMismatchError struct {
+	// Host is the address that was connected to.
+	Host string
+
+	// Fingerprint is the SHA256 fingerprint of the key the server presented.
+	Fingerprint string
+
+	// Expected lists the fingerprints that would have been accepted, if known.
+	Expected []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	if len(e.Expected) == 0 {
+		return fmt.Sprintf("Host key for %s doesn't match, server presented %s", e.Host, e.Fingerprint)
+	}
+	return fmt.Sprintf("Host key for %s doesn't match, server presented %s but expected %s",
+		e.Host, e.Fingerprint, strings.Join(e.Expected, " or "))
+}
+
+// WithHostKeyCallback verifies the server's host key with callback, which may
+// come from the knownhosts package or be written by hand.
+func WithHostKeyCallback(callback ssh.HostKeyCallback) Option {
+	return func(o *options) {
+		o.hostKeyCallback, o.hostKeyTypes = callback, nil
+	}
+}
+
+// WithHostKeyAlias checks the host key under alias instead of the host
+// connected to, like ssh's HostKeyAlias, for hosts on changing addresses
+// behind a stable name. The host key callbacks, including the known_hosts
+// lookup of WithKnownHosts and WithHostKeyUpdates, see alias as the hostname.
+// It may include a port; entries without one are for port 22.
+func WithHostKeyAlias(alias string) Option {
+	if _, _, err := net.SplitHostPort(alias); err != nil {
+		alias = net.JoinHostPort(alias, "22")
+	}
+	return func(o *options) {
+		o.hostKeyAlias = alias
+	}
+}
+
+// hostKeyHostname returns the hostname host keys are checked under.
+func (o *options) hostKeyHostname(host string) string {
+	if o.hostKeyAlias != "" {
+		return o.hostKeyAlias
+	}
+	return host
+}
+
+// WithHostKeyFingerprint only accepts a server whose host key has one of the
+// given SHA256 fingerprints, in the "SHA256:..." form ssh-keygen -l prints.
+// For host certificates the fingerprint of the certified key is also checked.
+// Other keys are rejected with a *HostKeyMismatchError.
+func WithHostKeyFingerprint(fingerprints ...string) Option {
+	expected := make([]string, len(fingerprints))
+	for i, fingerprint := range fingerprints {
+		expected[i] = strings.TrimRight(strings.TrimSpace(fingerprint), "=")
+	}
+
+	return WithHostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := []string{ssh.FingerprintSHA256(key)}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			presented = append(presented, ssh.FingerprintSHA256(cert.Key))
+		}
+
+		for _, want := range expected {
+			for _, got := range presented {
+				if got == want {
+					return nil
+				}
+			}
+		}
+
+		return &HostKeyMismatchError{Host: hostname, Fingerprint: presented[0], Expected: expected}
+	})
+}
+
+// WithHostCertAuthority only accepts servers presenting a host certificate
+// signed by one of caKeys and valid for the host being connected to, like
+// @cert-authority lines in known_hosts. Servers presenting plain host keys are
+// rejected, so fleets whose host keys rotate under a CA can be verified
+// without pinning every key.
+func WithHostCertAuthority(caKeys ...ssh.PublicKey) Option {
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			for _, ca := range caKeys {
+				if bytes.Equal(auth.Marshal(), ca.Marshal()) {
+					return true
+				}
+			}
+			return false
+		},
+		HostKeyFallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return errors.New("Host presented a plain host key but a certificate is required")
+		},
+	}
+
+	return func(o *options) {
+		o.hostKeyCallback, o.hostKeyTypes = checker.CheckHostKey, nil
+	}
+}
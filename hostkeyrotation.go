@@ -0,0 +1,143 @@
+package simplessh
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The OpenSSH extension servers use to announce all of their host keys after
+// authentication and the request clients send to have the server prove it
+// holds the private keys.
+const (
+	hostKeysRequest      = "hostkeys-00@openssh.com"
+	hostKeysProveRequest = "hostkeys-prove-00@openssh.com"
+)
+
+// A HostKeysFunc is called with the host keys an OpenSSH server announces
+// after authentication, once the server has proven it holds their private
+// keys. hostname and remote are the same as for the ssh.HostKeyCallback.
+type HostKeysFunc func(hostname string, remote net.Addr, keys []ssh.PublicKey)
+
+// WithHostKeyUpdates collects the host keys OpenSSH servers announce with the
+// hostkeys-00@openssh.com extension, like ssh with UpdateHostKeys. Servers
+// publish new keys this way ahead of retiring the old ones, so recording them
+// keeps clients working across a rotation. The keys are made available by
+// Client.HostKeys and passed to callback, which may be nil, and which can be
+// KnownHostsUpdater to add them to known_hosts.
+func WithHostKeyUpdates(callback HostKeysFunc) Option {
+	return func(o *options) {
+		o.hostKeyUpdates = true
+		o.hostKeysCallback = callback
+	}
+}
+
+// HostKeys returns the host keys the server announced, if WithHostKeyUpdates
+// was given and the server supports the extension. The server sends them
+// shortly after authentication, so they may not be available right away.
+func (c *Client) HostKeys() []ssh.PublicKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hostKeys
+}
+
+// handleGlobalRequests passes the global requests from in on to the
+// ssh.Client through out, except for host key announcements which are handled
+// here.
+func (c *Client) handleGlobalRequests(in <-chan *ssh.Request, out chan<- *ssh.Request, conn ssh.Conn, hostname string, callback HostKeysFunc) {
+	defer close(out)
+
+	for req := range in {
+		if req.Type != hostKeysRequest {
+			out <- req
+			continue
+		}
+		if req.WantReply {
+			req.Reply(false, nil)
+		}
+		// Proving the keys waits for a reply, which can't arrive while
+		// global requests aren't being read.
+		go c.updateHostKeys(conn, hostname, req.Payload, callback)
+	}
+}
+
+// updateHostKeys has the server prove it holds the private keys of the
+// announced keys and records those that check out.
+func (c *Client) updateHostKeys(conn ssh.Conn, hostname string, payload []byte, callback HostKeysFunc) {
+	blobs, err := parseStrings(payload)
+	if err != nil {
+		return
+	}
+
+	var keys []ssh.PublicKey
+	var request []byte
+	for _, blob := range blobs {
+		// Keys of types this package doesn't know are skipped, as ssh does.
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+		request = appendString(request, blob)
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	ok, response, err := conn.SendRequest(hostKeysProveRequest, true, request)
+	if err != nil || !ok {
+		return
+	}
+	signatures, err := parseStrings(response)
+	if err != nil || len(signatures) != len(keys) {
+		return
+	}
+
+	for i, key := range keys {
+		var signature ssh.Signature
+		if err := ssh.Unmarshal(signatures[i], &signature); err != nil {
+			return
+		}
+
+		var data []byte
+		data = appendString(data, []byte(hostKeysProveRequest))
+		data = appendString(data, conn.SessionID())
+		data = appendString(data, key.Marshal())
+		if err := key.Verify(data, &signature); err != nil {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	c.hostKeys = keys
+	c.mu.Unlock()
+
+	if callback != nil {
+		callback(hostname, conn.RemoteAddr(), keys)
+	}
+}
+
+// parseStrings splits data into the SSH wire format strings it consists of.
+func parseStrings(data []byte) ([][]byte, error) {
+	var strs [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("Truncated string")
+		}
+		n := binary.BigEndian.Uint32(data)
+		if uint64(len(data)-4) < uint64(n) {
+			return nil, errors.New("Truncated string")
+		}
+		strs = append(strs, data[4:4+n])
+		data = data[4+n:]
+	}
+	return strs, nil
+}
+
+func appendString(buf, s []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
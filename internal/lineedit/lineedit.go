@@ -0,0 +1,40 @@
+// Package lineedit edits text files line by line, for simplessh's LineInFile
+// and the fake of it in simplesshtest.
+package lineedit
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Edit replaces the lines of content matching re with line, appending line
+// if none match, when ensurePresent is set, and removes them otherwise.
+func Edit(content []byte, re *regexp.Regexp, line string, ensurePresent bool) []byte {
+	var out bytes.Buffer
+	found := false
+	for rest := content; len(rest) > 0; {
+		current, next, hasNewline := bytes.Cut(rest, []byte("\n"))
+		rest = next
+
+		switch {
+		case !re.Match(current):
+			out.Write(current)
+		case ensurePresent:
+			found = true
+			out.WriteString(line)
+		default:
+			continue
+		}
+		if hasNewline {
+			out.WriteByte('\n')
+		}
+	}
+
+	if ensurePresent && !found {
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,215 @@
+package simplessh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// JobDir is where jobs keep their pid, output and exit status on the remote
+// host, relative to the home directory.
+const JobDir = ".simplessh/jobs"
+
+// A Job is a command running detached from the SSH connection, started with
+// StartJob. It outlives the session and the connection it was started with
+// and can be picked up from another connection with Client.Job and its ID.
+// Jobs need a POSIX shell on the remote host.
+type Job struct {
+	ID string
+
+	client *Client
+}
+
+// A JobState tells whether a job is still running and if not, how it ended.
+type JobState int
+
+const (
+	// JobRunning jobs haven't finished yet.
+	JobRunning JobState = iota
+
+	// JobExited jobs finished on their own, see JobStatus.ExitStatus.
+	JobExited
+
+	// JobKilled jobs were stopped by Kill.
+	JobKilled
+
+	// JobLost jobs aren't running and didn't record how they ended, for
+	// example because the host rebooted.
+	JobLost
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobExited:
+		return "exited"
+	case JobKilled:
+		return "killed"
+	}
+	return "lost"
+}
+
+// JobStatus is the state of a job.
+type JobStatus struct {
+	State JobState
+
+	// ExitStatus of a job that exited on its own.
+	ExitStatus int
+
+	// Signal sent by Kill to a job that was killed.
+	Signal ssh.Signal
+}
+
+// StartJob starts cmd in the background on the remote host, detached from the
+// session with nohup and setsid where available, and returns right away. The
+// command's stdout and stderr are kept in a log on the remote host.
+func (c *Client) StartJob(cmd string) (*Job, error) {
+	if c.platform.Windows() {
+		return nil, errors.New("Jobs aren't supported on Windows hosts")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	job := c.Job(hex.EncodeToString(id))
+
+	// The wrapper records the command's exit status once it's done. It gets
+	// the job directory and the command as arguments so neither needs to be
+	// quoted twice.
+	script := job.dirVar() + `
+umask 077 && mkdir -p "$d" || exit 1
+setsid=
+command -v setsid >/dev/null 2>&1 && setsid=setsid
+$setsid nohup sh -c 'sh -c "$2"; echo $? > "$1/exit.tmp" && mv "$1/exit.tmp" "$1/exit"' simplessh-job "$d" ` + Quote(cmd) + ` > "$d/log" 2>&1 < /dev/null &
+echo $! > "$d/pid"`
+
+	if _, err := job.exec(script, false); err != nil {
+		return nil, fmt.Errorf("Couldn't start job: %w", err)
+	}
+	c.log().Info("Job started", "job", job.ID, "cmd", c.redactedCommand(cmd))
+
+	return job, nil
+}
+
+// Job returns the job with the given ID, which may have been started from
+// another connection.
+func (c *Client) Job(id string) *Job {
+	return &Job{ID: id, client: c}
+}
+
+// Status reports whether the job is still running and how it ended if not.
+func (j *Job) Status() (JobStatus, error) {
+	output, err := j.exec(j.dirVar()+`
+[ -d "$d" ] || { echo missing; exit 0; }
+if kill -0 "$(cat "$d/pid" 2>/dev/null)" 2>/dev/null; then echo running
+elif [ -f "$d/exit" ]; then echo "exited $(cat "$d/exit")"
+elif [ -f "$d/killed" ]; then echo "killed $(cat "$d/killed")"
+else echo lost; fi`, true)
+	if err != nil {
+		return JobStatus{}, err
+	}
+
+	state, value, _ := strings.Cut(strings.TrimSpace(string(output)), " ")
+	switch state {
+	case "running":
+		return JobStatus{State: JobRunning}, nil
+	case "exited":
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return JobStatus{}, fmt.Errorf("Job %s has an invalid exit status %q", j.ID, value)
+		}
+		return JobStatus{State: JobExited, ExitStatus: status}, nil
+	case "killed":
+		return JobStatus{State: JobKilled, Signal: ssh.Signal(value)}, nil
+	case "lost":
+		return JobStatus{State: JobLost}, nil
+	}
+	return JobStatus{}, fmt.Errorf("No job %s on %s", j.ID, j.client.host)
+}
+
+// Logs writes the job's output so far to w. With follow it keeps writing new
+// output as it's produced until the job is no longer running or ctx is done.
+func (j *Job) Logs(ctx context.Context, w io.Writer, follow bool) error {
+	script := j.dirVar() + `
+cat "$d/log"`
+	if follow {
+		script = j.dirVar() + `
+tail -c +1 -f "$d/log" &
+tail=$!
+trap 'kill $tail 2>/dev/null; exit' TERM INT HUP
+while kill -0 "$(cat "$d/pid")" 2>/dev/null; do sleep 1; done
+sleep 1
+kill $tail`
+	}
+
+	o := newExecOptions([]ExecOption{readOnly, WithCommandContext(ctx)})
+	return j.client.run(script, w, io.Discard, o)
+}
+
+// Wait polls the job's status every poll interval, every second if zero,
+// until it's no longer running or ctx is done.
+func (j *Job) Wait(ctx context.Context, poll time.Duration) (JobStatus, error) {
+	if poll <= 0 {
+		poll = time.Second
+	}
+
+	for {
+		status, err := j.Status()
+		if err != nil || status.State != JobRunning {
+			return status, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Kill sends signal to the job's process group, or only to the job's process
+// if setsid wasn't available to start it in its own group.
+func (j *Job) Kill(signal ssh.Signal) error {
+	sig := Quote(string(signal))
+	_, err := j.exec(j.dirVar()+`
+pid=$(cat "$d/pid") || exit 1
+echo `+sig+` > "$d/killed"
+kill -s `+sig+` "-$pid" 2>/dev/null || kill -s `+sig+` "$pid"`, false)
+	return err
+}
+
+// Remove deletes the job's pid, log and exit status from the remote host. It
+// doesn't stop the job.
+func (j *Job) Remove() error {
+	_, err := j.exec(j.dirVar()+`
+rm -rf "$d"`, false)
+	return err
+}
+
+// dirVar returns a shell assignment of the job's directory to $d.
+func (j *Job) dirVar() string {
+	return `d="$HOME"/` + Quote(JobDir+"/"+j.ID)
+}
+
+func (j *Job) exec(script string, read bool) ([]byte, error) {
+	opts := []ExecOption{}
+	if read {
+		opts = append(opts, readOnly)
+	}
+
+	stdout, stderr, err := j.client.ExecWithOutputStreams(script, opts...)
+	if err != nil && len(stderr) > 0 {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(stderr)))
+	}
+	return stdout, err
+}
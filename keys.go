@@ -0,0 +1,215 @@
+package simplessh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// A PassphraseFunc returns the passphrase for the encrypted private key
+// identified by name, which is the key's path or empty for keys that weren't
+// loaded from a file. It's only called once a key turns out to be encrypted.
+type PassphraseFunc func(name string) ([]byte, error)
+
+// Connect with a private key protected by a passphrase. Both PEM and
+// OpenSSH-format encrypted keys are supported. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyPassphrase(host, username, privKey, passphrase string, opts ...Option) (*Client, error) {
+	return ConnectWithKeyPassphraseTimeout(host, username, privKey, passphrase, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithKeyPassphrase but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyPassphraseTimeout(host, username, privKey, passphrase string, timeout time.Duration, opts ...Option) (*Client, error) {
+	signer, err := ParsePrivateKey([]byte(privKey), "", func(string) ([]byte, error) {
+		return []byte(passphrase), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authMethod := publicKeys(opts, signer)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// Connect with a private key file protected by a passphrase. If privKeyPath is
+// an empty string it will attempt to use $HOME/.ssh/id_rsa. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyFilePassphrase(host, username, privKeyPath, passphrase string, opts ...Option) (*Client, error) {
+	return ConnectWithKeyFilePassphraseTimeout(host, username, privKeyPath, passphrase, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithKeyFilePassphrase but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyFilePassphraseTimeout(host, username, privKeyPath, passphrase string, timeout time.Duration, opts ...Option) (*Client, error) {
+	privKey, err := readKeyFile(privKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ConnectWithKeyPassphraseTimeout(host, username, string(privKey), passphrase, timeout, opts...)
+}
+
+// Connect with a private key file, calling passphrase only if the key is
+// encrypted. If privKeyPath is an empty string it will attempt to use
+// $HOME/.ssh/id_rsa. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyFilePassphraseFunc(host, username, privKeyPath string, passphrase PassphraseFunc, opts ...Option) (*Client, error) {
+	return ConnectWithKeyFilePassphraseFuncTimeout(host, username, privKeyPath, passphrase, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithKeyFilePassphraseFunc but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithKeyFilePassphraseFuncTimeout(host, username, privKeyPath string, passphrase PassphraseFunc, timeout time.Duration, opts ...Option) (*Client, error) {
+	privKey, err := readKeyFile(privKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ParsePrivateKey(privKey, privKeyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	authMethod := publicKeys(opts, signer)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// ParsePrivateKey parses a private key, asking passphrase for the passphrase
+// only if the key is encrypted. A nil passphrase makes encrypted keys fail
+// with *ssh.PassphraseMissingError. name is passed on to passphrase.
+//
+// Besides the PEM and OpenSSH formats ssh understands, PKCS#8, PKCS#1 and SEC
+// 1 keys in DER form and PuTTY .ppk files (versions 2 and 3) are detected and
+// converted.
+func ParsePrivateKey(privKey []byte, name string, passphrase PassphraseFunc) (ssh.Signer, error) {
+	if bytes.HasPrefix(privKey, []byte("PuTTY-User-Key-File-")) {
+		return parsePPK(privKey, name, passphrase)
+	}
+	if !bytes.Contains(privKey, []byte("-----BEGIN ")) {
+		return parseDERKey(privKey)
+	}
+
+	signer, err := ssh.ParsePrivateKey(privKey)
+	if err != nil && isSecurityKeyFile(privKey) {
+		return nil, errors.New("Security key (sk-*) private key files can't be used directly, add the key to an ssh-agent and connect with the agent")
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) || passphrase == nil {
+		return signer, err
+	}
+
+	secret, err := passphrase(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKeyWithPassphrase(privKey, secret)
+}
+
+// isSecurityKeyFile reports whether privKey is an OpenSSH private key file for
+// a FIDO2 security key. The public key is stored unencrypted after the header.
+func isSecurityKeyFile(privKey []byte) bool {
+	block, _ := pem.Decode(privKey)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return false
+	}
+
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return false
+	}
+
+	r := &wireReader{data: block.Bytes[len(magic):]}
+	r.bytes() // cipher name
+	r.bytes() // KDF name
+	r.bytes() // KDF options
+	if r.err != nil || len(r.data) < 4 {
+		return false
+	}
+	r.data = r.data[4:] // number of keys
+	pub, err := ssh.ParsePublicKey(r.bytes())
+	if r.err != nil || err != nil {
+		return false
+	}
+
+	return isSecurityKey(pub)
+}
+
+// parseDERKey parses an unencrypted binary PKCS#8, PKCS#1 or SEC 1 key.
+func parseDERKey(der []byte) (ssh.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return ssh.NewSignerFromKey(key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return ssh.NewSignerFromKey(key)
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return ssh.NewSignerFromKey(key)
+	}
+	return nil, errors.New("Unrecognized private key format")
+}
+
+// TerminalPassphrase is a PassphraseFunc that prompts for the passphrase on the
+// controlling terminal with echo turned off, like ssh does.
+func TerminalPassphrase(name string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		// No controlling terminal, e.g. on Windows. Fall back to stdin if
+		// it is one.
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errors.New("No terminal to read the passphrase from")
+		}
+		tty = os.Stdin
+	} else {
+		defer tty.Close()
+	}
+
+	prompt := "Enter passphrase: "
+	if name != "" {
+		prompt = fmt.Sprintf("Enter passphrase for key '%s': ", name)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	return term.ReadPassword(int(tty.Fd()))
+}
+
+// Connect with a key that's only accessible through a crypto.Signer, such as
+// one held by a PKCS#11 token, an HSM or a cloud KMS, so the private key never
+// needs to exist as a file. If username is empty simplessh will attempt to get the current user.
+func ConnectWithSigner(host, username string, signer crypto.Signer, opts ...Option) (*Client, error) {
+	return ConnectWithSignerTimeout(host, username, signer, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithSigner but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithSignerTimeout(host, username string, signer crypto.Signer, timeout time.Duration, opts ...Option) (*Client, error) {
+	sshSigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	authMethod := publicKeys(opts, sshSigner)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// readKeyFile reads a private key, defaulting to $HOME/.ssh/id_rsa when path
+// is empty.
+func readKeyFile(path string) ([]byte, error) {
+	if path == "" {
+		currentUser, err := user.Current()
+		if err == nil {
+			path = filepath.Join(currentUser.HomeDir, ".ssh", "id_rsa")
+		}
+	}
+
+	return os.ReadFile(path)
+}
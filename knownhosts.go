@@ -0,0 +1,255 @@
+package simplessh
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// A HostKeyPolicy decides what happens to host keys that aren't in
+// known_hosts, like ssh's StrictHostKeyChecking.
+type HostKeyPolicy int
+
+const (
+	// HostKeyStrict rejects hosts that aren't in known_hosts.
+	HostKeyStrict HostKeyPolicy = iota
+
+	// HostKeyAcceptNew records the keys of hosts that aren't in known_hosts
+	// yet and accepts them, while still rejecting changed keys.
+	HostKeyAcceptNew
+
+	// HostKeyInsecure accepts any host key without checking known_hosts.
+	HostKeyInsecure
+)
+
+// An UnknownHostKeyError is returned by HostKeyStrict when the host isn't in
+// known_hosts.
+type UnknownHostKeyError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("Host %s isn't in known_hosts, server presented %s", e.Host, e.Fingerprint)
+}
+
+// knownHostsMu serializes appending to known_hosts files so concurrent
+// connections to a new host don't record it more than once.
+var knownHostsMu sync.Mutex
+
+// WithKnownHosts verifies host keys against known_hosts files, by default
+// $HOME/.ssh/known_hosts, handling unknown hosts according to policy. New keys
+// are recorded in the first file, with hashed hostnames if the file already
+// contains hashed entries as written by ssh with HashKnownHosts. The files are
+// read again for every connection so keys recorded by one connection are seen
+// by the next.
+//
+// As with ssh, the host key algorithms, whichever options set them, are
+// reordered to prefer the types of the keys recorded for the host. A key that
+// doesn't match the recorded one of its type fails with a
+// *HostKeyMismatchError, a key of a type not recorded for the host is handled
+// like an unknown host.
+func WithKnownHosts(policy HostKeyPolicy, files ...string) Option {
+	if policy == HostKeyInsecure {
+		return WithHostKeyCallback(ssh.InsecureIgnoreHostKey())
+	}
+
+	if len(files) == 0 {
+		files = []string{filepath.Join(homeDir(), ".ssh", "known_hosts")}
+	}
+
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		err := checkKnownHosts(files, hostname, remote, key)
+
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+
+		mismatch := &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+		for _, known := range keyErr.Want {
+			if known.Key.Type() == key.Type() {
+				mismatch.Expected = append(mismatch.Expected, ssh.FingerprintSHA256(known.Key))
+			}
+		}
+		if len(mismatch.Expected) > 0 {
+			return mismatch
+		}
+
+		if policy != HostKeyAcceptNew {
+			return &UnknownHostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+		}
+
+		return appendKnownHost(files[0], hostname, key)
+	}
+
+	return func(o *options) {
+		o.hostKeyCallback = callback
+		o.hostKeyTypes = func(hostname string) []string {
+			return knownHostKeyTypes(files, hostname)
+		}
+	}
+}
+
+// noKey is a host key no host has, for looking up the keys recorded for a
+// host.
+var noKey, _ = ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+
+// knownHostKeyTypes returns the types of the keys recorded for hostname.
+func knownHostKeyTypes(files []string, hostname string) []string {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	keyErr, ok := checkKnownHosts(files, hostname, &net.TCPAddr{}, noKey).(*knownhosts.KeyError)
+	if !ok {
+		return nil
+	}
+	var types []string
+	for _, known := range keyErr.Want {
+		if !slices.Contains(types, known.Key.Type()) {
+			types = append(types, known.Key.Type())
+		}
+	}
+	return types
+}
+
+// preferHostKeyTypes moves the host key algorithms for keys of the given
+// types to the front of algorithms, or of the package defaults if it's empty.
+func preferHostKeyTypes(algorithms, types []string) []string {
+	if len(types) == 0 {
+		return algorithms
+	}
+	if len(algorithms) == 0 {
+		algorithms = append(ssh.SupportedAlgorithms().HostKeys, ssh.KeyAlgoRSA)
+	}
+
+	var preferred, rest []string
+	for _, algorithm := range algorithms {
+		keyType := algorithm
+		if algorithm == ssh.KeyAlgoRSASHA256 || algorithm == ssh.KeyAlgoRSASHA512 {
+			keyType = ssh.KeyAlgoRSA
+		}
+		if slices.Contains(types, keyType) {
+			preferred = append(preferred, algorithm)
+		} else {
+			rest = append(rest, algorithm)
+		}
+	}
+	return append(preferred, rest...)
+}
+
+// checkKnownHosts checks key against the files that exist. Missing files are
+// treated as empty, so every host is unknown until one is recorded.
+func checkKnownHosts(files []string, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	var existing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	if len(existing) == 0 {
+		return &knownhosts.KeyError{}
+	}
+
+	callback, err := knownhosts.New(existing...)
+	if err != nil {
+		return err
+	}
+
+	return callback(hostname, remote, key)
+}
+
+func appendKnownHost(file, hostname string, key ssh.PublicKey) error {
+	hashed, err := usesHashedHosts(file)
+	if err != nil {
+		return err
+	}
+
+	address := knownhosts.Normalize(hostname)
+	if hashed {
+		address = knownhosts.HashHostname(address)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{address}, key))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// usesHashedHosts reports whether any entry of the known_hosts file has a
+// hashed hostname. A missing file isn't hashed.
+func usesHashedHosts(file string) (bool, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// Skip markers such as @cert-authority to get to the hosts.
+		hosts := fields[0]
+		if strings.HasPrefix(hosts, "@") && len(fields) > 1 {
+			hosts = fields[1]
+		}
+		if strings.HasPrefix(hosts, "|1|") {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// KnownHostsUpdater returns a HostKeysFunc for WithHostKeyUpdates that records
+// the keys a server announces in the first known_hosts file, by default
+// $HOME/.ssh/known_hosts, unless one of the files already has them. Keys the
+// server no longer announces are left in place.
+func KnownHostsUpdater(files ...string) HostKeysFunc {
+	if len(files) == 0 {
+		files = []string{filepath.Join(homeDir(), ".ssh", "known_hosts")}
+	}
+
+	return func(hostname string, remote net.Addr, keys []ssh.PublicKey) {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		for _, key := range keys {
+			err := checkKnownHosts(files, hostname, remote, key)
+			if _, ok := err.(*knownhosts.KeyError); !ok {
+				continue
+			}
+			if err := appendKnownHost(files[0], hostname, key); err != nil {
+				return
+			}
+		}
+	}
+}
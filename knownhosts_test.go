@@ -0,0 +1,150 @@
+package simplessh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hostKeyServer starts an SSH server with the given host keys that lets
+// anyone in and doesn't serve anything.
+func hostKeyServer(t *testing.T, hostKeys ...ssh.Signer) string {
+	t.Helper()
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	for _, key := range hostKeys {
+		config.AddHostKey(key)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				defer sshConn.Close()
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					newChannel.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestKnownHostsKeyTypes(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Signer, err := ssh.NewSignerFromKey(ed25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	both := hostKeyServer(t, rsaSigner, ed25519Signer)
+	rsaOnly := hostKeyServer(t, rsaSigner)
+
+	tests := []struct {
+		name     string
+		addr     string
+		recorded []ssh.PublicKey
+		policy   HostKeyPolicy
+		err      error
+		appended bool
+	}{
+		{"recorded type preferred", both, []ssh.PublicKey{ed25519Signer.PublicKey()}, HostKeyStrict, nil, false},
+		{"recorded type preferred accept-new", both, []ssh.PublicKey{ed25519Signer.PublicKey()}, HostKeyAcceptNew, nil, false},
+		{"changed key", both, []ssh.PublicKey{otherSigner.PublicKey()}, HostKeyStrict, ErrHostKeyMismatch, false},
+		{"changed key accept-new", both, []ssh.PublicKey{otherSigner.PublicKey()}, HostKeyAcceptNew, ErrHostKeyMismatch, false},
+		{"other type", rsaOnly, []ssh.PublicKey{ed25519Signer.PublicKey()}, HostKeyStrict, ErrUnknownHost, false},
+		{"other type accept-new", rsaOnly, []ssh.PublicKey{ed25519Signer.PublicKey()}, HostKeyAcceptNew, nil, true},
+		{"unknown host", both, nil, HostKeyStrict, ErrUnknownHost, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "known_hosts")
+			var lines []string
+			for _, key := range tt.recorded {
+				lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(tt.addr)}, key)+"\n")
+			}
+			if err := os.WriteFile(file, []byte(strings.Join(lines, "")), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			client, err := ConnectWithPassword(tt.addr, "deploy", "", WithKnownHosts(tt.policy, file))
+			if err == nil {
+				client.Close()
+			}
+			if tt.err == nil && err != nil || !errors.Is(err, tt.err) {
+				t.Fatalf("ConnectWithPassword error = %v, want %v", err, tt.err)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if appended := strings.Count(string(data), "\n") > len(lines); appended != tt.appended {
+				t.Errorf("key appended = %v, want %v", appended, tt.appended)
+			}
+		})
+	}
+}
+
+func TestPreferHostKeyTypes(t *testing.T) {
+	algorithms := []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoECDSA256, ssh.KeyAlgoED25519}
+	tests := []struct {
+		types []string
+		want  []string
+	}{
+		{nil, algorithms},
+		{[]string{ssh.KeyAlgoED25519}, []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoECDSA256}},
+		{[]string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSA}, []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256}},
+	}
+	for _, tt := range tests {
+		got := preferHostKeyTypes(algorithms, tt.types)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("preferHostKeyTypes(%v) = %v, want %v", tt.types, got, tt.want)
+		}
+	}
+
+	if got := preferHostKeyTypes(nil, []string{ssh.KeyAlgoED25519}); len(got) == 0 || got[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("preferHostKeyTypes of the defaults = %v, want ssh-ed25519 first", got)
+	}
+}
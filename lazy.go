@@ -0,0 +1,164 @@
+package simplessh
+
+import (
+	"os"
+	"sync"
+	"text/template"
+)
+
+// A LazyClient only connects when it's first used, and connects again when
+// it's used after Close, so programs can set up clients for many hosts and
+// only connect to those they need.
+type LazyClient struct {
+	target string
+	chain  AuthChain
+	opts   []Option
+
+	mu     sync.Mutex
+	client *Client
+}
+
+var _ Clienter = (*LazyClient)(nil)
+
+// NewLazyClient returns a LazyClient connecting to target, as accepted by
+// ParseTarget, with ConnectWithAuthChain.
+func NewLazyClient(target string, chain AuthChain, opts ...Option) *LazyClient {
+	return &LazyClient{target: target, chain: chain, opts: opts}
+}
+
+// Client returns the connected Client, connecting first if needed. It's how
+// the methods of Client that LazyClient doesn't have are used.
+func (l *LazyClient) Client() (*Client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.client != nil {
+		return l.client, nil
+	}
+	client, err := ConnectWithAuthChain(l.target, "", l.chain, l.opts...)
+	if err != nil {
+		return nil, err
+	}
+	l.client = client
+	return client, nil
+}
+
+// Connected reports whether the LazyClient is connected.
+func (l *LazyClient) Connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.client != nil
+}
+
+// Close closes the connection, if there's one.
+func (l *LazyClient) Close() error {
+	l.mu.Lock()
+	client := l.client
+	l.client = nil
+	l.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
+
+// Exec is Client.Exec, connecting first if needed.
+func (l *LazyClient) Exec(cmd string, opts ...ExecOption) ([]byte, error) {
+	client, err := l.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Exec(cmd, opts...)
+}
+
+// ExecWithOutputStreams is Client.ExecWithOutputStreams, connecting first if needed.
+func (l *LazyClient) ExecWithOutputStreams(cmd string, opts ...ExecOption) ([]byte, []byte, error) {
+	client, err := l.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.ExecWithOutputStreams(cmd, opts...)
+}
+
+// RunScript is Client.RunScript, connecting first if needed.
+func (l *LazyClient) RunScript(path string, args []string, opts ...ExecOption) ([]byte, error) {
+	client, err := l.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.RunScript(path, args, opts...)
+}
+
+// Upload is Client.Upload, connecting first if needed.
+func (l *LazyClient) Upload(local, remote string, opts ...TransferOption) error {
+	client, err := l.Client()
+	if err != nil {
+		return err
+	}
+	return client.Upload(local, remote, opts...)
+}
+
+// Download is Client.Download, connecting first if needed.
+func (l *LazyClient) Download(remote, local string, opts ...TransferOption) error {
+	client, err := l.Client()
+	if err != nil {
+		return err
+	}
+	return client.Download(remote, local, opts...)
+}
+
+// ReadAll is Client.ReadAll, connecting first if needed.
+func (l *LazyClient) ReadAll(filepath string) ([]byte, error) {
+	client, err := l.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.ReadAll(filepath)
+}
+
+// Rename is Client.Rename, connecting first if needed.
+func (l *LazyClient) Rename(oldpath, newpath string) error {
+	client, err := l.Client()
+	if err != nil {
+		return err
+	}
+	return client.Rename(oldpath, newpath)
+}
+
+// StatVFS is Client.StatVFS, connecting first if needed.
+func (l *LazyClient) StatVFS(path string) (*VFSStat, error) {
+	client, err := l.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.StatVFS(path)
+}
+
+// EnsureFile is Client.EnsureFile, connecting first if needed.
+func (l *LazyClient) EnsureFile(path string, content []byte, mode os.FileMode, owner string) (bool, error) {
+	client, err := l.Client()
+	if err != nil {
+		return false, err
+	}
+	return client.EnsureFile(path, content, mode, owner)
+}
+
+// UploadTemplate is Client.UploadTemplate, connecting first if needed.
+func (l *LazyClient) UploadTemplate(tmpl *template.Template, data any, remotePath string, mode os.FileMode) error {
+	client, err := l.Client()
+	if err != nil {
+		return err
+	}
+	return client.UploadTemplate(tmpl, data, remotePath, mode)
+}
+
+// LineInFile is Client.LineInFile, connecting first if needed.
+func (l *LazyClient) LineInFile(path, match, line string, ensurePresent bool) (bool, error) {
+	client, err := l.Client()
+	if err != nil {
+		return false, err
+	}
+	return client.LineInFile(path, match, line, ensurePresent)
+}
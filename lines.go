@@ -0,0 +1,87 @@
+package simplessh
+
+import (
+	"bytes"
+	"sync"
+)
+
+// A Stream tells which output of a command a line was written to.
+type Stream int
+
+const (
+	Stdout Stream = iota
+	Stderr
+)
+
+func (s Stream) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// maxLineLength is the longest line passed to a line callback, longer ones
+// are split.
+const maxLineLength = 64 * 1024
+
+// Execute cmd on the remote host and call fn with every line of its output as
+// it arrives, without the line ending. Calls are never concurrent, so fn
+// doesn't need locking. With WithExecRetry the lines of failed attempts have
+// already been passed to fn when the command is run again.
+func (c *Client) ExecWithLineCallback(cmd string, fn func(stream Stream, line string), opts ...ExecOption) error {
+	o := newExecOptions(opts)
+
+	var mu sync.Mutex
+	return o.retry.do(o.context(), func() error {
+		stdout := &lineWriter{stream: Stdout, fn: fn, mu: &mu}
+		stderr := &lineWriter{stream: Stderr, fn: fn, mu: &mu}
+		err := c.run(cmd, stdout, stderr, o)
+		stdout.flush()
+		stderr.flush()
+		return err
+	})
+}
+
+// A lineWriter splits what's written to it into lines.
+type lineWriter struct {
+	stream Stream
+	fn     func(Stream, string)
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			for len(w.buf) >= maxLineLength {
+				w.fn(w.stream, string(w.buf[:maxLineLength]))
+				w.buf = w.buf[maxLineLength:]
+			}
+			break
+		}
+		w.buf = append(w.buf, p[:i]...)
+		w.fn(w.stream, string(bytes.TrimSuffix(w.buf, []byte("\r"))))
+		w.buf = w.buf[:0]
+		p = p[i+1:]
+	}
+
+	return n, nil
+}
+
+// flush passes on the last line if it didn't end with a newline.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(w.stream, string(bytes.TrimSuffix(w.buf, []byte("\r"))))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,22 @@
+package simplessh
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{stream: Stdout, fn: func(_ Stream, line string) {
+		lines = append(lines, line)
+	}, mu: &sync.Mutex{}}
+
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\n\r\nlast\r"))
+	w.flush()
+
+	if want := []string{"first", "second", "", "last"}; !slices.Equal(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
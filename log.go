@@ -0,0 +1,55 @@
+package simplessh
+
+import (
+	"log/slog"
+	"time"
+)
+
+// WithLogger logs what the connection does to logger: connecting and
+// closing, the keys offered for authentication, commands being run and
+// finishing, with secrets redacted as in an AuditLog, and transfer summaries.
+// Routine events are logged at the debug level, completed operations at info
+// and failures at warn. Use slog.New(handler) to log through any
+// slog.Handler. Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+func (o *options) log() *slog.Logger {
+	if o.logger == nil {
+		return discardLogger
+	}
+	return o.logger
+}
+
+// log returns the Client's logger, which also works for Clients that weren't
+// made by one of the Connect functions.
+func (c *Client) log() *slog.Logger {
+	if c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// redactedCommand returns cmd for logging, with its secrets redacted using the
+// patterns of the AuditLog, or DefaultRedactions without one.
+func (c *Client) redactedCommand(cmd string) string {
+	if c.auditLog != nil {
+		return c.auditLog.RedactString(cmd)
+	}
+	return (&AuditLog{}).RedactString(cmd)
+}
+
+// logTransfer logs the summary of an upload or download.
+func (c *Client) logTransfer(kind, remote, local string, bytes int64, start time.Time, err error) {
+	logger := c.log().With("remote", remote, "local", local, "bytes", bytes, "duration", time.Since(start))
+	if err != nil {
+		logger.Warn(kind+" failed", "error", err)
+		return
+	}
+	logger.Info(kind + " finished")
+}
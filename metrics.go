@@ -0,0 +1,93 @@
+package simplessh
+
+import "time"
+
+// A MetricsRecorder is told what connections do so fleets of them can be
+// monitored. The simplesshprom package implements it with Prometheus metrics.
+// Its methods are called concurrently and shouldn't block.
+type MetricsRecorder interface {
+	// ConnectionOpened is called once a connection to host is established.
+	ConnectionOpened(host string)
+
+	// ConnectionFailed is called when connecting to host failed, after any
+	// retries. errors.Is tells apart failures such as ErrAuthFailed.
+	ConnectionFailed(host string, err error)
+
+	// ConnectionClosed is called when an established connection is closed.
+	ConnectionClosed(host string)
+
+	// CommandFinished is called when a command run by Exec and the functions
+	// built on it is done, err is nil if it exited with status 0.
+	CommandFinished(host string, duration time.Duration, err error)
+
+	// Transferred is called after an upload or a download, with direction
+	// "upload" or "download", including those that failed part way.
+	Transferred(host, direction string, bytes int64)
+
+	// ChannelOpened and ChannelClosed are called around the use of a channel
+	// of the connection, telling how busy it is. Kind is "session" for
+	// commands, "sftp" for file transfers and "forward" for forwarded
+	// connections.
+	ChannelOpened(host, kind string)
+	ChannelClosed(host, kind string)
+}
+
+// WithMetrics reports connections, commands, transfers and channel use to
+// recorder.
+func WithMetrics(recorder MetricsRecorder) Option {
+	return func(o *options) {
+		o.metrics = recorder
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ConnectionOpened(string)                      {}
+func (noopMetrics) ConnectionFailed(string, error)               {}
+func (noopMetrics) ConnectionClosed(string)                      {}
+func (noopMetrics) CommandFinished(string, time.Duration, error) {}
+func (noopMetrics) Transferred(string, string, int64)            {}
+func (noopMetrics) ChannelOpened(string, string)                 {}
+func (noopMetrics) ChannelClosed(string, string)                 {}
+
+func (o *options) recorder() MetricsRecorder {
+	if o.metrics == nil {
+		return noopMetrics{}
+	}
+	return o.metrics
+}
+
+// recorder returns the Client's MetricsRecorder, which also works for Clients
+// that weren't made by one of the Connect functions.
+func (c *Client) recorder() MetricsRecorder {
+	if c.metrics == nil {
+		return noopMetrics{}
+	}
+	return c.metrics
+}
+
+// watchConnection records the connection as closed once it ends, including
+// when the server or the network drops it.
+func (c *Client) watchConnection() {
+	go func() {
+		c.SSHClient.Wait()
+		c.connectionClosed()
+	}()
+}
+
+// connectionClosed records that the connection was closed, once.
+func (c *Client) connectionClosed() {
+	if !c.closed.Swap(true) {
+		c.recorder().ConnectionClosed(c.host)
+	}
+}
+
+// openChannel records that a channel of kind is in use and returns the
+// function recording that it no longer is.
+func (c *Client) openChannel(kind string) func() {
+	recorder := c.recorder()
+	recorder.ChannelOpened(c.host, kind)
+	return func() {
+		recorder.ChannelClosed(c.host, kind)
+	}
+}
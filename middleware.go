@@ -0,0 +1,66 @@
+package simplessh
+
+import (
+	"context"
+	"io"
+)
+
+// An ExecFunc runs cmd on the remote host, writing its output to stdout and
+// stderr. The command is stopped when ctx is done.
+type ExecFunc func(ctx context.Context, cmd string, stdout, stderr io.Writer) error
+
+// An ExecMiddleware wraps every command run by Exec and the functions built
+// on it. It can inspect or rewrite the command, refuse to run it by returning
+// an error without calling next, or act on the outcome of next. Middleware
+// is called once per attempt when WithExecRetry is used.
+type ExecMiddleware func(next ExecFunc) ExecFunc
+
+// WithExecMiddleware registers middleware on the connection as if with Use.
+func WithExecMiddleware(middleware ...ExecMiddleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+// Use adds middleware around every command run on c from now on. The first
+// middleware registered is the outermost one.
+func (c *Client) Use(middleware ...ExecMiddleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], middleware...)
+}
+
+// run runs cmd through the middleware chain.
+func (c *Client) run(cmd string, stdout, stderr io.Writer, o *execOptions) error {
+	exec := c.chain(func(ctx context.Context, cmd string, stdout, stderr io.Writer) error {
+		withCtx := *o
+		withCtx.ctx = ctx
+		return c.exec(cmd, stdout, stderr, &withCtx)
+	}, o.readOnly)
+
+	return exec(o.context(), cmd, stdout, stderr)
+}
+
+// chain wraps exec, which runs commands, in the middleware and makes the
+// commands subject to the policies and, unless readOnly, dry-run mode.
+func (c *Client) chain(exec ExecFunc, readOnly bool) ExecFunc {
+	c.mu.Lock()
+	middleware := c.middleware
+	c.mu.Unlock()
+
+	next := func(ctx context.Context, cmd string, stdout, stderr io.Writer) error {
+		if err := c.checkPolicies(cmd); err != nil {
+			return err
+		}
+		if !readOnly && c.planned(PlannedAction{Kind: "exec", Command: cmd}) {
+			return nil
+		}
+		return exec(ctx, cmd, stdout, stderr)
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		next = middleware[i](next)
+	}
+
+	return next
+}
@@ -0,0 +1,152 @@
+package simplessh
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// An Option configures how a connection is established. Options are accepted
+// by all of the Connect functions.
+type Option func(*options)
+
+type options struct {
+	forwardAgent    bool
+	agent           agent.ExtendedAgent
+	agentConn       io.Closer
+	hostKeyCallback ssh.HostKeyCallback
+	hostKeyTypes    func(hostname string) []string
+	hostKeyAlias    string
+	dial            DialFunc
+	tls             *tls.Config
+	proxyProtocol   int
+	srvLookup       bool
+	defaultPort     string
+
+	config              ssh.Config
+	hostKeyAlgorithms   []string
+	publicKeyAlgorithms []string
+	clientVersion       string
+	bannerCallback      ssh.BannerCallback
+	minRSABits          int
+	forbidSHA1          bool
+	compression         bool
+
+	dialTimeout      time.Duration
+	handshakeTimeout time.Duration
+	authTimeout      time.Duration
+
+	retry   RetryPolicy
+	breaker *CircuitBreaker
+
+	logger *slog.Logger
+	trace  bool
+
+	tracer  trace.Tracer
+	ctx     context.Context
+	metrics MetricsRecorder
+	audit   *AuditLog
+	plan    *Plan
+
+	platform Platform
+	become   *Become
+
+	hooks           []Hooks
+	transferSummary func(TransferSummary)
+
+	middleware []ExecMiddleware
+	policies   []*CommandPolicy
+
+	maxSessions  int
+	sessionLimit SessionLimitPolicy
+	spillConns   int
+
+	hostKeyUpdates   bool
+	hostKeysCallback HostKeysFunc
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		// Host keys have never been verified by default, keep it that way
+		// unless one of the host key options is given.
+		hostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		dial:            dialHappyEyeballs(&net.Dialer{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.restrictAlgorithms()
+	if o.hostKeyAlias != "" {
+		callback := o.hostKeyCallback
+		o.hostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return callback(o.hostKeyAlias, remote, key)
+		}
+	}
+	return o
+}
+
+// WithAgentForwarding forwards the local ssh-agent to every session opened on
+// the connection, the equivalent of ssh -A. The remote sshd points
+// SSH_AUTH_SOCK at the forwarded agent so commands like git clone can use the
+// local keys. Only enable it for hosts you trust: anyone with root on the
+// remote host can use the agent while the connection is open.
+func WithAgentForwarding() Option {
+	return func(o *options) {
+		o.forwardAgent = true
+	}
+}
+
+// WithClientVersion sets the identification string sent to the server, such
+// as "SSH-2.0-myapp_1.4", in place of Go's generic one so server logs show
+// which program connected. The "SSH-2.0-" prefix is added if it's missing.
+func WithClientVersion(version string) Option {
+	if !strings.HasPrefix(version, "SSH-2.0-") {
+		version = "SSH-2.0-" + version
+	}
+	return func(o *options) {
+		o.clientVersion = version
+	}
+}
+
+// WithBannerCallback calls callback with the banner the server sends before
+// authentication, for environments where it has to be displayed or logged.
+// ssh.BannerDisplayStderr shows it the way ssh does. The last banner is also
+// available from Client.Banner.
+func WithBannerCallback(callback ssh.BannerCallback) Option {
+	return func(o *options) {
+		o.bannerCallback = callback
+	}
+}
+
+// WithDefaultPort sets the port connected to when the host doesn't specify
+// one, such as 830 for NETCONF, in place of DefaultPort.
+func WithDefaultPort(port string) Option {
+	return func(o *options) {
+		o.defaultPort = port
+	}
+}
+
+func (o *options) port() string {
+	if o.defaultPort != "" {
+		return o.defaultPort
+	}
+	return DefaultPort
+}
+
+// withAgent hands the agent used for authentication to the Client so agent
+// forwarding can reuse it. A non-nil conn is closed with the Client, or right
+// away if connecting fails.
+func withAgent(keyring agent.ExtendedAgent, conn io.Closer) Option {
+	return func(o *options) {
+		o.agent = keyring
+		o.agentConn = conn
+	}
+}
@@ -0,0 +1,227 @@
+package simplessh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const gceMetadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+
+// OSLogin connects to Google Compute Engine VMs managed with OS Login. A key
+// pair is generated in memory and its public key is imported into the login
+// profile of Email through the OS Login API, which also tells which POSIX
+// username to log in as. The key is imported again when it's about to expire.
+// On GCE every field can be left empty: the VM's default service account and
+// its credentials from the metadata server are used.
+type OSLogin struct {
+	// Email of the user or service account to log in as, defaults to the
+	// metadata server's default service account.
+	Email string
+
+	// ProjectID the POSIX account belongs to, optional.
+	ProjectID string
+
+	// Token returns an OAuth2 access token with the compute scope, defaults
+	// to the metadata server's token for the default service account.
+	Token func(ctx context.Context) (string, error)
+
+	// KeyTTL is how long the imported key stays valid, 10 minutes if zero.
+	KeyTTL time.Duration
+
+	// HTTPClient makes the API requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	key      ssh.Signer
+	username string
+	expires  time.Time
+}
+
+// Connect to host as the POSIX user OS Login assigns to l.Email.
+func ConnectWithOSLogin(host string, l *OSLogin, opts ...Option) (*Client, error) {
+	return ConnectWithOSLoginTimeout(host, l, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithOSLogin but allows a custom timeout.
+func ConnectWithOSLoginTimeout(host string, l *OSLogin, timeout time.Duration, opts ...Option) (*Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	signer, username, err := l.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	authMethod := publicKeys(opts, signer)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// Signer returns the key to authenticate with and the POSIX username to log
+// in as, importing the key if it hasn't been yet or is about to expire.
+func (l *OSLogin) Signer(ctx context.Context) (ssh.Signer, string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.key != nil && time.Now().Add(time.Minute).Before(l.expires) {
+		return l.key, l.username, nil
+	}
+
+	key, err := newEphemeralSigner()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ttl := l.KeyTTL
+	if ttl == 0 {
+		ttl = 10 * time.Minute
+	}
+	expires := time.Now().Add(ttl)
+
+	username, err := l.importKey(ctx, key.PublicKey(), expires)
+	if err != nil {
+		return nil, "", err
+	}
+
+	l.key, l.username, l.expires = key, username, expires
+	return key, username, nil
+}
+
+func (l *OSLogin) importKey(ctx context.Context, pub ssh.PublicKey, expires time.Time) (string, error) {
+	token := l.Token
+	if token == nil {
+		token = l.metadataToken
+	}
+	accessToken, err := token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	email := l.Email
+	if email == "" {
+		if email, err = l.metadata(ctx, "instance/service-accounts/default/email"); err != nil {
+			return "", err
+		}
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"key":                string(ssh.MarshalAuthorizedKey(pub)),
+		"expirationTimeUsec": strconv.FormatInt(expires.UnixMicro(), 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := "https://oslogin.googleapis.com/v1/users/" + url.PathEscape(email) + ":importSshPublicKey"
+	if l.ProjectID != "" {
+		endpoint += "?projectId=" + url.QueryEscape(l.ProjectID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var response struct {
+		LoginProfile struct {
+			PosixAccounts []struct {
+				Primary  bool   `json:"primary"`
+				Username string `json:"username"`
+			} `json:"posixAccounts"`
+		} `json:"loginProfile"`
+	}
+	if err := l.do(req, &response); err != nil {
+		return "", fmt.Errorf("OS Login key import failed: %v", err)
+	}
+
+	accounts := response.LoginProfile.PosixAccounts
+	for _, account := range accounts {
+		if account.Primary {
+			return account.Username, nil
+		}
+	}
+	if len(accounts) > 0 {
+		return accounts[0].Username, nil
+	}
+
+	return "", fmt.Errorf("OS Login profile of %s has no POSIX account", email)
+}
+
+func (l *OSLogin) metadataToken(ctx context.Context) (string, error) {
+	data, err := l.metadata(ctx, "instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("Metadata server returned no access token")
+	}
+
+	return token.AccessToken, nil
+}
+
+// metadata reads a value from the GCE metadata server.
+func (l *OSLogin) metadata(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gceMetadataURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := l.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Couldn't reach the GCE metadata server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Metadata server returned %s for %s", resp.Status, path)
+	}
+
+	return string(data), nil
+}
+
+func (l *OSLogin) do(req *http.Request, response interface{}) error {
+	resp, err := l.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func (l *OSLogin) httpClient() *http.Client {
+	if l.HTTPClient != nil {
+		return l.HTTPClient
+	}
+	return http.DefaultClient
+}
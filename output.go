@@ -0,0 +1,109 @@
+package simplessh
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WithMaxOutputBytes keeps at most the first n bytes of the command's output,
+// for Exec the combined output and for ExecWithOutputStreams each stream, so
+// a command printing gigabytes can't exhaust memory. The command keeps
+// running and the rest of its output is read and dropped. When output was
+// dropped an *OutputTruncatedError is returned along with any error of the
+// command.
+func WithMaxOutputBytes(n int) ExecOption {
+	return func(o *execOptions) {
+		o.maxOutput, o.keepTail = n, false
+	}
+}
+
+// WithOutputTail is like WithMaxOutputBytes but keeps the last n bytes of
+// the output, where the reason a command failed usually is.
+func WithOutputTail(n int) ExecOption {
+	return func(o *execOptions) {
+		o.maxOutput, o.keepTail = n, true
+	}
+}
+
+// An OutputTruncatedError is returned when part of a command's output was
+// dropped because of WithMaxOutputBytes or WithOutputTail.
+type OutputTruncatedError struct {
+	Cmd     string
+	Limit   int
+	Dropped int64
+}
+
+func (e *OutputTruncatedError) Error() string {
+	return fmt.Sprintf("Output of command %q exceeded %d bytes, %d bytes were dropped", e.Cmd, e.Limit, e.Dropped)
+}
+
+// truncated adds an *OutputTruncatedError to err if any of bufs dropped
+// output.
+func (o *execOptions) truncated(cmd string, err error, bufs ...*outputBuffer) error {
+	var dropped int64
+	for _, buf := range bufs {
+		dropped += buf.dropped
+	}
+	if dropped == 0 {
+		return err
+	}
+
+	return errors.Join(err, &OutputTruncatedError{Cmd: cmd, Limit: o.maxOutput, Dropped: dropped})
+}
+
+// An outputBuffer collects output, keeping the first or the last limit bytes
+// if limit is positive.
+type outputBuffer struct {
+	limit int
+	tail  bool
+
+	buf     []byte
+	start   int // of the oldest byte once a tail buffer is full
+	dropped int64
+}
+
+func (o *execOptions) newOutputBuffer() *outputBuffer {
+	return &outputBuffer{limit: o.maxOutput, tail: o.keepTail}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	switch {
+	case b.limit <= 0:
+		b.buf = append(b.buf, p...)
+	case !b.tail:
+		keep := min(b.limit-len(b.buf), len(p))
+		b.buf = append(b.buf, p[:keep]...)
+		b.dropped += int64(len(p) - keep)
+	case len(p) >= b.limit:
+		b.dropped += int64(len(b.buf) + len(p) - b.limit)
+		b.buf = append(b.buf[:0], p[len(p)-b.limit:]...)
+		b.start = 0
+	default:
+		keep := min(b.limit-len(b.buf), len(p))
+		b.buf = append(b.buf, p[:keep]...)
+		p = p[keep:]
+		// The buffer is full, overwrite the oldest bytes.
+		for len(p) > 0 {
+			copied := copy(b.buf[b.start:], p)
+			b.start = (b.start + copied) % b.limit
+			b.dropped += int64(copied)
+			p = p[copied:]
+		}
+	}
+
+	return n, nil
+}
+
+// Bytes returns the output kept, oldest first.
+func (b *outputBuffer) Bytes() []byte {
+	if b.start == 0 {
+		return b.buf
+	}
+	return append(append([]byte(nil), b.buf[b.start:]...), b.buf[:b.start]...)
+}
+
+func (b *outputBuffer) Reset() {
+	b.buf, b.start, b.dropped = b.buf[:0], 0, 0
+}
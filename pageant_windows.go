@@ -0,0 +1,151 @@
+//go:build windows
+
+package simplessh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Pageant is reached by writing the request into a named file mapping and
+// sending its name to the Pageant window in a WM_COPYDATA message. The reply
+// is written back into the same mapping.
+const (
+	pageantMaxMessage = 8192
+	pageantCopyDataID = 0x804e50ba
+	wmCopyData        = 0x004a
+)
+
+var (
+	user32             = syscall.NewLazyDLL("user32.dll")
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procFindWindowW    = user32.NewProc("FindWindowW")
+	procSendMessageW   = user32.NewProc("SendMessageW")
+	procRtlMoveMemory  = kernel32.NewProc("RtlMoveMemory")
+	pageantRequestSeq  atomic.Uint32
+	errPageantNotFound = errors.New("Pageant isn't running")
+)
+
+type copyDataStruct struct {
+	dwData uintptr
+	cbData uint32
+	lpData uintptr
+}
+
+// pageantConn speaks the ssh-agent protocol with Pageant. Every complete
+// request written to it is sent as one query and the reply is buffered for
+// the following reads.
+type pageantConn struct {
+	request []byte
+	reply   []byte
+}
+
+func dialPageant() (*pageantConn, error) {
+	if pageantWindow() == 0 {
+		return nil, errPageantNotFound
+	}
+	return &pageantConn{}, nil
+}
+
+func pageantWindow() uintptr {
+	name, _ := syscall.UTF16PtrFromString("Pageant")
+	hwnd, _, _ := procFindWindowW.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(name)))
+	return hwnd
+}
+
+func (c *pageantConn) Write(p []byte) (int, error) {
+	c.request = append(c.request, p...)
+
+	for len(c.request) >= 4 {
+		size := 4 + int(binary.BigEndian.Uint32(c.request))
+		if size > pageantMaxMessage {
+			c.request = nil
+			return 0, errors.New("Agent request too large for Pageant")
+		}
+		if len(c.request) < size {
+			break
+		}
+
+		reply, err := queryPageant(c.request[:size])
+		c.request = c.request[size:]
+		if err != nil {
+			return 0, err
+		}
+		c.reply = append(c.reply, reply...)
+	}
+
+	return len(p), nil
+}
+
+func (c *pageantConn) Read(p []byte) (int, error) {
+	if len(c.reply) == 0 {
+		return 0, errors.New("No reply from Pageant pending")
+	}
+	n := copy(p, c.reply)
+	c.reply = c.reply[n:]
+	return n, nil
+}
+
+func (c *pageantConn) Close() error {
+	c.request, c.reply = nil, nil
+	return nil
+}
+
+// queryPageant sends one length-prefixed agent message and returns the
+// length-prefixed reply.
+func queryPageant(request []byte) ([]byte, error) {
+	hwnd := pageantWindow()
+	if hwnd == 0 {
+		return nil, errPageantNotFound
+	}
+
+	mapName := fmt.Sprintf("PageantRequest%08x%04x", syscall.Getpid(), pageantRequestSeq.Add(1))
+	mapNamePtr, err := syscall.UTF16PtrFromString(mapName)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := syscall.CreateFileMapping(syscall.InvalidHandle, nil, syscall.PAGE_READWRITE, 0, pageantMaxMessage, mapNamePtr)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create the Pageant file mapping: %v", err)
+	}
+	defer syscall.CloseHandle(mapping)
+
+	view, err := syscall.MapViewOfFile(mapping, syscall.FILE_MAP_WRITE, 0, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't map the Pageant file mapping: %v", err)
+	}
+	defer syscall.UnmapViewOfFile(view)
+
+	procRtlMoveMemory.Call(view, uintptr(unsafe.Pointer(&request[0])), uintptr(len(request)))
+
+	// Pageant expects the ANSI name of the mapping.
+	name := append([]byte(mapName), 0)
+	cds := copyDataStruct{
+		dwData: pageantCopyDataID,
+		cbData: uint32(len(name)),
+		lpData: uintptr(unsafe.Pointer(&name[0])),
+	}
+	ret, _, _ := procSendMessageW.Call(hwnd, wmCopyData, 0, uintptr(unsafe.Pointer(&cds)))
+	runtime.KeepAlive(name)
+	if ret == 0 {
+		return nil, errors.New("Pageant refused the request")
+	}
+
+	header := make([]byte, 4)
+	procRtlMoveMemory.Call(uintptr(unsafe.Pointer(&header[0])), view, 4)
+	size := 4 + int(binary.BigEndian.Uint32(header))
+	if size > pageantMaxMessage {
+		return nil, errors.New("Pageant reply is too large")
+	}
+
+	reply := make([]byte, size)
+	procRtlMoveMemory.Call(uintptr(unsafe.Pointer(&reply[0])), view, uintptr(size))
+
+	return reply, nil
+}
@@ -0,0 +1,166 @@
+package simplessh
+
+import (
+	"bytes"
+	"strings"
+)
+
+// A Platform is the kind of remote host, which decides how commands are
+// quoted, how paths are written and how output is normalized.
+type Platform int
+
+const (
+	// Unix hosts run commands with a POSIX shell. It's the default.
+	Unix Platform = iota
+
+	// WindowsCmd are Windows OpenSSH servers with the default shell, where
+	// commands are run by cmd.exe.
+	WindowsCmd
+
+	// WindowsPowerShell are Windows OpenSSH servers with PowerShell set as
+	// DefaultShell.
+	WindowsPowerShell
+)
+
+func (p Platform) String() string {
+	switch p {
+	case WindowsCmd:
+		return "windows-cmd"
+	case WindowsPowerShell:
+		return "windows-powershell"
+	}
+	return "unix"
+}
+
+// Windows reports whether p is one of the Windows platforms.
+func (p Platform) Windows() bool {
+	return p == WindowsCmd || p == WindowsPowerShell
+}
+
+// WithRemotePlatform tells what kind of host is connected to, so the same
+// API works against Windows fleets:
+//
+//   - Quote, QuoteArgs, Quotef and Execf on the Client quote for cmd.exe or
+//     PowerShell.
+//   - Remote paths given to Upload, Download, ReadAll and the other file
+//     helpers may use backslashes and drive letters, such as C:\Temp\app.log.
+//   - CRLF line endings in the output of Exec and ExecWithOutputStreams are
+//     turned into LF.
+//   - RunScript uploads scripts to the user's home directory with a .cmd or
+//     .ps1 extension.
+//
+// Windows has no signals, commands stopped by WithCommandTimeout are ended
+// by closing their session. Exit statuses are those of the process, such as
+// 0xC000013A for one that was interrupted, or 1 when a PowerShell command
+// failed without calling exit.
+func WithRemotePlatform(platform Platform) Option {
+	return func(o *options) {
+		o.platform = platform
+	}
+}
+
+// Platform returns the kind of remote host set with WithRemotePlatform.
+func (c *Client) Platform() Platform {
+	return c.platform
+}
+
+// Quote quotes s as a single argument for the remote host's shell, see the
+// Quote function for Unix hosts.
+func (c *Client) Quote(s string) string {
+	switch c.platform {
+	case WindowsCmd:
+		return quoteCmd(s)
+	case WindowsPowerShell:
+		return quotePowerShell(s)
+	}
+	return Quote(s)
+}
+
+// QuoteArgs quotes every argument with c.Quote and joins them with spaces.
+func (c *Client) QuoteArgs(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = c.Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Quotef is like the Quotef function but quotes for the remote host's shell.
+func (c *Client) Quotef(format string, args ...any) string {
+	return quotef(c.Quote, format, args...)
+}
+
+// quoteCmd quotes s so the program cmd.exe starts receives it as a single
+// argument: it's quoted the way CommandLineToArgvW parses arguments and then
+// every character cmd.exe treats specially is escaped with ^, which also
+// stops %VAR% and !VAR! expansion.
+func quoteCmd(s string) string {
+	var argv strings.Builder
+	argv.WriteByte('"')
+	backslashes := 0
+	for _, r := range s {
+		switch r {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			argv.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			argv.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		argv.WriteRune(r)
+	}
+	argv.WriteString(strings.Repeat(`\`, 2*backslashes))
+	argv.WriteByte('"')
+
+	var b strings.Builder
+	for _, r := range argv.String() {
+		if strings.ContainsRune(`()%!^"<>&|`, r) {
+			b.WriteByte('^')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// quotePowerShell quotes s as a verbatim PowerShell string, in which only
+// quotes need escaping. PowerShell also takes typographic single quotes as
+// quotes.
+func quotePowerShell(s string) string {
+	return "'" + strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b").Replace(s) + "'"
+}
+
+// remotePath turns Windows paths such as C:\Temp\app.log into the
+// /C:/Temp/app.log form SFTP servers on Windows expect.
+func (c *Client) remotePath(p string) string {
+	if !c.platform.Windows() {
+		return p
+	}
+	p = strings.ReplaceAll(p, `\`, "/")
+	if len(p) >= 2 && p[1] == ':' && isDriveLetter(p[0]) {
+		p = "/" + p
+	}
+	return p
+}
+
+// windowsPath turns an SFTP path such as /C:/Temp/app.log back into
+// C:\Temp\app.log for use in commands.
+func windowsPath(p string) string {
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' && isDriveLetter(p[1]) {
+		p = p[1:]
+	}
+	return strings.ReplaceAll(p, "/", `\`)
+}
+
+func isDriveLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// normalizeOutput turns CRLF line endings into LF for Windows hosts.
+func (c *Client) normalizeOutput(output []byte) []byte {
+	if !c.platform.Windows() {
+		return output
+	}
+	return bytes.ReplaceAll(output, []byte("\r\n"), []byte("\n"))
+}
@@ -0,0 +1,128 @@
+package simplessh
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// A CommandPolicy decides which commands may run. Commands are checked right
+// before they'd be sent to the host, after any Exec middleware rewrote them,
+// and rejected with a *PolicyError.
+type CommandPolicy struct {
+	// Hosts and Users limit the policy to hosts and users matching one of
+	// the patterns, where '*' matches any run of characters and '?' exactly
+	// one. Hosts are matched with and without the port. Empty means all.
+	Hosts []string
+	Users []string
+
+	// Deny rejects commands matching any of the patterns.
+	Deny []*regexp.Regexp
+
+	// Allow, if not empty, rejects commands that match none of the patterns.
+	// Anchor the patterns with ^ and $ to match the whole command.
+	Allow []*regexp.Regexp
+
+	// Check, if set, rejects commands it returns an error for.
+	Check func(host, user, cmd string) error
+}
+
+// A PolicyError is returned for commands a CommandPolicy didn't allow to run.
+type PolicyError struct {
+	Host   string
+	User   string
+	Cmd    string
+	Reason string
+
+	err error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("Command %q isn't allowed on %s: %s", e.Cmd, e.Host, e.Reason)
+}
+
+// Unwrap returns the error of the policy's Check function, if it rejected
+// the command.
+func (e *PolicyError) Unwrap() error {
+	return e.err
+}
+
+// WithCommandPolicy checks every command run on the connection against the
+// policies. All the policies applying to the host and user must allow it.
+func WithCommandPolicy(policies ...*CommandPolicy) Option {
+	return func(o *options) {
+		o.policies = append(o.policies, policies...)
+	}
+}
+
+// checkPolicies returns a *PolicyError if a policy rejects cmd.
+func (c *Client) checkPolicies(cmd string) error {
+	for _, p := range c.policies {
+		if !p.appliesTo(c.host, c.user) {
+			continue
+		}
+		if reason, err := p.check(c.host, c.user, cmd); reason != "" {
+			c.log().Warn("Command rejected by policy", "cmd", c.redactedCommand(cmd), "reason", reason)
+			return &PolicyError{Host: c.host, User: c.user, Cmd: cmd, Reason: reason, err: err}
+		}
+	}
+	return nil
+}
+
+// check returns why cmd is rejected, or an empty string if it isn't.
+func (p *CommandPolicy) check(host, user, cmd string) (string, error) {
+	for _, pattern := range p.Deny {
+		if pattern.MatchString(cmd) {
+			return fmt.Sprintf("matches denied pattern %q", pattern), nil
+		}
+	}
+
+	if len(p.Allow) > 0 {
+		allowed := false
+		for _, pattern := range p.Allow {
+			if pattern.MatchString(cmd) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "matches no allowed pattern", nil
+		}
+	}
+
+	if p.Check != nil {
+		if err := p.Check(host, user, cmd); err != nil {
+			if err.Error() == "" {
+				return "rejected by Check", err
+			}
+			return err.Error(), err
+		}
+	}
+
+	return "", nil
+}
+
+func (p *CommandPolicy) appliesTo(host, user string) bool {
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+	return matchesAny(p.Hosts, host, hostname) && matchesAny(p.Users, user)
+}
+
+// matchesAny reports whether any of values matches one of patterns, or true
+// if there are no patterns.
+func matchesAny(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matchWildcard(strings.ToLower(pattern), strings.ToLower(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+package simplessh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// ppkKey is the content of a PuTTY .ppk private key file.
+type ppkKey struct {
+	version    int
+	algorithm  string
+	encryption string
+	comment    string
+	public     []byte
+	private    []byte
+	mac        []byte
+	headers    map[string]string
+}
+
+// parsePPK parses a PuTTY private key file in the version 2 or 3 format,
+// decrypting it with a passphrase from passphrase if needed.
+func parsePPK(data []byte, name string, passphrase PassphraseFunc) (ssh.Signer, error) {
+	key, err := readPPK(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := ssh.ParsePublicKey(key.public)
+	if err != nil {
+		return nil, fmt.Errorf("PuTTY key has an invalid public key: %v", err)
+	}
+
+	var secret []byte
+	if key.encryption != "none" {
+		if key.encryption != "aes256-cbc" {
+			return nil, fmt.Errorf("PuTTY key uses unsupported encryption %q", key.encryption)
+		}
+		if passphrase == nil {
+			return nil, &ssh.PassphraseMissingError{PublicKey: pub}
+		}
+		if secret, err = passphrase(name); err != nil {
+			return nil, err
+		}
+	}
+
+	cipherKey, iv, macKey, err := key.deriveKeys(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	private := key.private
+	if cipherKey != nil {
+		if len(private)%aes.BlockSize != 0 {
+			return nil, errors.New("PuTTY key has a truncated private key")
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		private = make([]byte, len(key.private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, key.private)
+	}
+
+	newHash := sha1.New
+	if key.version == 3 {
+		newHash = sha256.New
+	}
+	if !hmac.Equal(key.computeMAC(newHash, macKey, private), key.mac) {
+		if cipherKey != nil {
+			return nil, x509.IncorrectPasswordError
+		}
+		return nil, errors.New("PuTTY key MAC doesn't match, the file is corrupt")
+	}
+
+	privKey, err := ppkPrivateKey(pub, private)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.NewSignerFromKey(privKey)
+}
+
+func readPPK(data []byte) (*ppkKey, error) {
+	key := &ppkKey{headers: make(map[string]string)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	readLines := func(count string) ([]byte, error) {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("PuTTY key has an invalid line count %q", count)
+		}
+		var encoded strings.Builder
+		for i := 0; i < n; i++ {
+			if !scanner.Scan() {
+				return nil, errors.New("PuTTY key is truncated")
+			}
+			encoded.WriteString(strings.TrimSpace(scanner.Text()))
+		}
+		return base64.StdEncoding.DecodeString(encoded.String())
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		field, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("PuTTY key has an invalid line %q", line)
+		}
+
+		var err error
+		switch field {
+		case "PuTTY-User-Key-File-2", "PuTTY-User-Key-File-3":
+			key.version = int(field[len(field)-1] - '0')
+			key.algorithm = value
+		case "Encryption":
+			key.encryption = value
+		case "Comment":
+			key.comment = value
+		case "Public-Lines":
+			key.public, err = readLines(value)
+		case "Private-Lines":
+			key.private, err = readLines(value)
+		case "Private-MAC":
+			key.mac, err = hex.DecodeString(value)
+		default:
+			key.headers[field] = value
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if key.version == 0 {
+		return nil, errors.New("Unsupported PuTTY key file version")
+	}
+	if key.public == nil || key.private == nil || key.mac == nil {
+		return nil, errors.New("PuTTY key is missing required fields")
+	}
+
+	return key, nil
+}
+
+// deriveKeys returns the AES key and IV to decrypt the private key with, both
+// nil for unencrypted keys, and the key of the file's MAC.
+func (key *ppkKey) deriveKeys(passphrase []byte) (cipherKey, iv, macKey []byte, err error) {
+	if key.version == 2 {
+		mac := sha1.Sum(append([]byte("putty-private-key-file-mac-key"), passphrase...))
+		if key.encryption == "none" {
+			return nil, nil, mac[:], nil
+		}
+
+		var derived []byte
+		for i := uint32(0); len(derived) < 32; i++ {
+			h := sha1.New()
+			binary.Write(h, binary.BigEndian, i)
+			h.Write(passphrase)
+			derived = h.Sum(derived)
+		}
+		return derived[:32], make([]byte, aes.BlockSize), mac[:], nil
+	}
+
+	if key.encryption == "none" {
+		return nil, nil, nil, nil
+	}
+
+	memory, err := strconv.ParseUint(key.headers["Argon2-Memory"], 10, 32)
+	if err != nil {
+		return nil, nil, nil, errors.New("PuTTY key has an invalid Argon2-Memory")
+	}
+	passes, err := strconv.ParseUint(key.headers["Argon2-Passes"], 10, 32)
+	if err != nil {
+		return nil, nil, nil, errors.New("PuTTY key has an invalid Argon2-Passes")
+	}
+	parallelism, err := strconv.ParseUint(key.headers["Argon2-Parallelism"], 10, 8)
+	if err != nil {
+		return nil, nil, nil, errors.New("PuTTY key has an invalid Argon2-Parallelism")
+	}
+	salt, err := hex.DecodeString(key.headers["Argon2-Salt"])
+	if err != nil {
+		return nil, nil, nil, errors.New("PuTTY key has an invalid Argon2-Salt")
+	}
+
+	const size = 32 + aes.BlockSize + 32
+	var derived []byte
+	switch key.headers["Key-Derivation"] {
+	case "Argon2id":
+		derived = argon2.IDKey(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), size)
+	case "Argon2i":
+		derived = argon2.Key(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), size)
+	default:
+		return nil, nil, nil, fmt.Errorf("PuTTY key uses unsupported key derivation %q", key.headers["Key-Derivation"])
+	}
+
+	return derived[:32], derived[32 : 32+aes.BlockSize], derived[32+aes.BlockSize:], nil
+}
+
+func (key *ppkKey) computeMAC(newHash func() hash.Hash, macKey, private []byte) []byte {
+	mac := hmac.New(newHash, macKey)
+	for _, field := range [][]byte{[]byte(key.algorithm), []byte(key.encryption), []byte(key.comment), key.public, private} {
+		binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+	return mac.Sum(nil)
+}
+
+// ppkPrivateKey combines the public key with the decrypted private blob into
+// a crypto private key.
+func ppkPrivateKey(pub ssh.PublicKey, private []byte) (interface{}, error) {
+	cryptoPub, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported PuTTY key type %s", pub.Type())
+	}
+
+	r := &wireReader{data: private}
+	switch pubKey := cryptoPub.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		d, p, q := r.mpint(), r.mpint(), r.mpint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		key := &rsa.PrivateKey{PublicKey: *pubKey, D: d, Primes: []*big.Int{p, q}}
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdsa.PublicKey:
+		d := r.mpint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pubKey, D: d}, nil
+	case ed25519.PublicKey:
+		// PuTTY writes the seed as a little-endian integer, dropping
+		// trailing zero bytes.
+		seed := r.bytes()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(seed) > ed25519.SeedSize {
+			return nil, errors.New("PuTTY key has an invalid ed25519 private key")
+		}
+		padded := make([]byte, ed25519.SeedSize)
+		copy(padded, seed)
+		return ed25519.NewKeyFromSeed(padded), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported PuTTY key type %s", pub.Type())
+}
+
+// wireReader decodes SSH wire format strings and mpints, remembering the
+// first error.
+type wireReader struct {
+	data []byte
+	err  error
+}
+
+func (r *wireReader) bytes() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < 4 {
+		r.err = errors.New("PuTTY key has a truncated private key")
+		return nil
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	if uint64(len(r.data)-4) < uint64(n) {
+		r.err = errors.New("PuTTY key has a truncated private key")
+		return nil
+	}
+	b := r.data[4 : 4+n]
+	r.data = r.data[4+n:]
+	return b
+}
+
+func (r *wireReader) mpint() *big.Int {
+	return new(big.Int).SetBytes(r.bytes())
+}
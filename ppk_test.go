@@ -0,0 +1,243 @@
+package simplessh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// ppkFile is a PuTTY key file to be written by encode.
+type ppkFile struct {
+	version    int
+	key        crypto.Signer
+	passphrase string
+	comment    string
+	// seed overrides the encoding of an ed25519 private key.
+	seed []byte
+}
+
+func ppkString(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+func ppkMPInt(i *big.Int) []byte {
+	b := i.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return ppkString(b)
+}
+
+// ppkLines base64 encodes b in lines of 64 characters, as PuTTY does.
+func ppkLines(b []byte) (int, string) {
+	encoded := base64.StdEncoding.EncodeToString(b)
+	var lines []string
+	for len(encoded) > 64 {
+		lines = append(lines, encoded[:64])
+		encoded = encoded[64:]
+	}
+	lines = append(lines, encoded)
+	return len(lines), strings.Join(lines, "\n")
+}
+
+func (f ppkFile) encode(t *testing.T) []byte {
+	t.Helper()
+
+	pub, err := ssh.NewPublicKey(f.key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var private []byte
+	switch key := f.key.(type) {
+	case *rsa.PrivateKey:
+		private = bytes.Join([][]byte{ppkMPInt(key.D), ppkMPInt(key.Primes[0]), ppkMPInt(key.Primes[1]), ppkMPInt(key.Precomputed.Qinv)}, nil)
+	case *ecdsa.PrivateKey:
+		private = ppkMPInt(key.D)
+	case ed25519.PrivateKey:
+		seed := key.Seed()
+		if f.seed != nil {
+			seed = f.seed
+		}
+		private = ppkString(seed)
+	}
+
+	encryption := "none"
+	var headers string
+	var cipherKey, iv, macKey []byte
+	newHash := sha1.New
+	if f.version == 3 {
+		newHash = sha256.New
+	}
+	switch {
+	case f.passphrase == "" && f.version == 2:
+		sum := sha1.Sum([]byte("putty-private-key-file-mac-key"))
+		macKey = sum[:]
+	case f.passphrase == "":
+	case f.version == 2:
+		encryption = "aes256-cbc"
+		h0 := sha1.Sum(append([]byte{0, 0, 0, 0}, f.passphrase...))
+		h1 := sha1.Sum(append([]byte{0, 0, 0, 1}, f.passphrase...))
+		cipherKey, iv = append(h0[:], h1[:12]...), make([]byte, aes.BlockSize)
+		sum := sha1.Sum([]byte("putty-private-key-file-mac-key" + f.passphrase))
+		macKey = sum[:]
+	default:
+		encryption = "aes256-cbc"
+		salt := []byte("0123456789abcdef")
+		headers = "Key-Derivation: Argon2id\nArgon2-Memory: 64\nArgon2-Passes: 1\nArgon2-Parallelism: 1\nArgon2-Salt: " + hex.EncodeToString(salt) + "\n"
+		derived := argon2.IDKey([]byte(f.passphrase), salt, 1, 64, 1, 80)
+		cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+	}
+	if cipherKey != nil {
+		for len(private)%aes.BlockSize != 0 {
+			private = append(private, 0)
+		}
+	}
+
+	mac := hmac.New(newHash, macKey)
+	for _, field := range [][]byte{[]byte(pub.Type()), []byte(encryption), []byte(f.comment), pub.Marshal(), private} {
+		mac.Write(ppkString(field))
+	}
+
+	if cipherKey != nil {
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(private, private)
+	}
+
+	publicCount, publicLines := ppkLines(pub.Marshal())
+	privateCount, privateLines := ppkLines(private)
+	return fmt.Appendf(nil, "PuTTY-User-Key-File-%d: %s\nEncryption: %s\nComment: %s\n%sPublic-Lines: %d\n%s\nPrivate-Lines: %d\n%s\nPrivate-MAC: %x\n",
+		f.version, pub.Type(), encryption, f.comment, headers, publicCount, publicLines, privateCount, privateLines, mac.Sum(nil))
+}
+
+func TestParsePPK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A seed ending in a zero byte, which PuTTY leaves out.
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	seed[ed25519.SeedSize-1] = 0
+	shortSeedKey := ed25519.NewKeyFromSeed(seed)
+
+	tests := []struct {
+		name string
+		file ppkFile
+	}{
+		{"v2 RSA", ppkFile{version: 2, key: rsaKey, comment: "rsa-key-20240101"}},
+		{"v2 RSA encrypted", ppkFile{version: 2, key: rsaKey, passphrase: "secret"}},
+		{"v2 ECDSA encrypted", ppkFile{version: 2, key: ecdsaKey, passphrase: "secret"}},
+		{"v2 ed25519", ppkFile{version: 2, key: ed25519Key}},
+		{"v3 RSA", ppkFile{version: 3, key: rsaKey}},
+		{"v3 ECDSA", ppkFile{version: 3, key: ecdsaKey, comment: "ecdsa"}},
+		{"v3 ed25519 encrypted", ppkFile{version: 3, key: ed25519Key, passphrase: "secret", comment: "ed25519 key"}},
+		{"v3 ed25519 short seed", ppkFile{version: 3, key: shortSeedKey, seed: seed[:ed25519.SeedSize-1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked string
+			passphrase := func(name string) ([]byte, error) {
+				asked = name
+				return []byte(tt.file.passphrase), nil
+			}
+			signer, err := ParsePrivateKey(tt.file.encode(t), "id.ppk", passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.file.passphrase != "" && asked != "id.ppk" {
+				t.Errorf("passphrase asked for %q, want id.ppk", asked)
+			}
+
+			want, err := ssh.NewPublicKey(tt.file.key.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(signer.PublicKey().Marshal(), want.Marshal()) {
+				t.Fatal("public key doesn't match")
+			}
+			sig, err := signer.Sign(rand.Reader, []byte("data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := want.Verify([]byte("data"), sig); err != nil {
+				t.Errorf("signature doesn't verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestParsePPKErrors(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := ppkFile{version: 3, key: key}.encode(t)
+	encrypted := ppkFile{version: 2, key: key, passphrase: "secret"}.encode(t)
+	wrong := func(string) ([]byte, error) { return []byte("wrong"), nil }
+	failing := func(string) ([]byte, error) { return nil, errors.New("Cancelled") }
+
+	corrupt := bytes.Replace(plain, []byte("Comment: "), []byte("Comment: changed"), 1)
+	// Cut off after the Private-Lines header.
+	cut := bytes.Index(plain, []byte("Private-Lines: "))
+	truncated := plain[:cut+bytes.IndexByte(plain[cut:], '\n')+1]
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase PassphraseFunc
+		check      func(error) bool
+	}{
+		{"wrong passphrase", encrypted, wrong, func(err error) bool { return errors.Is(err, x509.IncorrectPasswordError) }},
+		{"no passphrase", encrypted, nil, func(err error) bool {
+			var missing *ssh.PassphraseMissingError
+			return errors.As(err, &missing)
+		}},
+		{"passphrase error", encrypted, failing, func(err error) bool { return err != nil && err.Error() == "Cancelled" }},
+		{"corrupt", corrupt, nil, func(err error) bool { return err != nil && strings.Contains(err.Error(), "MAC") }},
+		{"truncated", truncated, nil, func(err error) bool { return err != nil && strings.Contains(err.Error(), "truncated") }},
+		{"unsupported version", bytes.Replace(plain, []byte("File-3"), []byte("File-4"), 1), nil, func(err error) bool { return err != nil }},
+		{"unsupported encryption", bytes.Replace(encrypted, []byte("aes256-cbc"), []byte("3des-cbc"), 1), wrong, func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), "3des-cbc")
+		}},
+		{"invalid line", append(append([]byte(nil), plain...), "garbage\n"...), nil, func(err error) bool { return err != nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePrivateKey(tt.data, "id.ppk", tt.passphrase)
+			if !tt.check(err) {
+				t.Errorf("ParsePrivateKey: unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package simplessh
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// A PrefixedOutput merges the output of commands running on many hosts at
+// once into a single writer, prefixing every line with the name of the host
+// it came from, like pdsh does. Lines are never interleaved with each other.
+type PrefixedOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewPrefixedOutput returns a PrefixedOutput writing to w.
+func NewPrefixedOutput(w io.Writer) *PrefixedOutput {
+	return &PrefixedOutput{w: w}
+}
+
+// WriteLine writes line prefixed with host. Any error writing to the
+// underlying writer is returned.
+func (p *PrefixedOutput) WriteLine(host, line string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := io.WriteString(p.w, host+": "+line+"\n")
+	return err
+}
+
+// Execute cmd on the remote host and write both its stdout and stderr to out
+// line by line as they arrive, prefixed with the host name. The port is left
+// out of the name unless it's not the default port, DefaultPort or the one
+// set with WithDefaultPort.
+func (c *Client) ExecWithPrefixedOutput(cmd string, out *PrefixedOutput, opts ...ExecOption) error {
+	name := c.host
+	if host, port, err := net.SplitHostPort(c.host); err == nil && port == c.port {
+		name = host
+	}
+
+	return c.ExecWithLineCallback(cmd, func(_ Stream, line string) {
+		out.WriteLine(name, line)
+	}, opts...)
+}
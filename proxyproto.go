@@ -0,0 +1,63 @@
+package simplessh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// WithProxyProtocol sends a HAProxy PROXY protocol header of version 1 or 2
+// as soon as the connection is dialed, for load balancers that expect one
+// before passing the connection on to sshd. The header gives the local and
+// remote addresses of the connection, or no addresses when it isn't a TCP
+// connection, such as with WithProxyCommand.
+func WithProxyProtocol(version int) Option {
+	return func(o *options) {
+		o.proxyProtocol = version
+	}
+}
+
+// proxyProtocolSignature starts a version 2 header.
+var proxyProtocolSignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolHeader returns the PROXY protocol header for conn.
+func proxyProtocolHeader(version int, conn net.Conn) ([]byte, error) {
+	src, srcOK := conn.LocalAddr().(*net.TCPAddr)
+	dst, dstOK := conn.RemoteAddr().(*net.TCPAddr)
+	known := srcOK && dstOK
+	ipv4 := known && src.IP.To4() != nil && dst.IP.To4() != nil
+
+	switch version {
+	case 1:
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		family := "TCP6"
+		if ipv4 {
+			family = "TCP4"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, src.IP, dst.IP, src.Port, dst.Port), nil
+
+	case 2:
+		header := append([]byte(nil), proxyProtocolSignature...)
+		if !known {
+			// A LOCAL command with no addresses.
+			return append(header, 0x20, 0x00, 0, 0), nil
+		}
+		var srcIP, dstIP net.IP
+		header = append(header, 0x21)
+		if ipv4 {
+			srcIP, dstIP = src.IP.To4(), dst.IP.To4()
+			header = append(header, 0x11)
+		} else {
+			srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+			header = append(header, 0x21)
+		}
+		header = binary.BigEndian.AppendUint16(header, uint16(2*len(srcIP)+4))
+		header = append(header, srcIP...)
+		header = append(header, dstIP...)
+		header = binary.BigEndian.AppendUint16(header, uint16(src.Port))
+		return binary.BigEndian.AppendUint16(header, uint16(dst.Port)), nil
+	}
+	return nil, fmt.Errorf("Unsupported PROXY protocol version %d", version)
+}
@@ -0,0 +1,74 @@
+package simplessh
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// addrConn is a net.Conn with the given addresses.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c addrConn) LocalAddr() net.Addr  { return c.local }
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestProxyProtocolHeader(t *testing.T) {
+	v4 := addrConn{
+		local:  &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000},
+		remote: &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 22},
+	}
+	v6 := addrConn{
+		local:  &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000},
+		remote: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 22},
+	}
+	mixed := addrConn{
+		local:  &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000},
+		remote: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 22},
+	}
+	unix := addrConn{
+		local:  &net.UnixAddr{Name: "@", Net: "unix"},
+		remote: &net.UnixAddr{Name: "/run/sshd.sock", Net: "unix"},
+	}
+	signature := "\r\n\r\n\x00\r\nQUIT\n"
+
+	tests := []struct {
+		name    string
+		version int
+		conn    net.Conn
+		want    string
+	}{
+		{"v1 IPv4", 1, v4, "PROXY TCP4 192.0.2.1 198.51.100.2 50000 22\r\n"},
+		{"v1 IPv6", 1, v6, "PROXY TCP6 2001:db8::1 2001:db8::2 50000 22\r\n"},
+		{"v1 mixed", 1, mixed, "PROXY TCP6 192.0.2.1 2001:db8::2 50000 22\r\n"},
+		{"v1 unknown", 1, unix, "PROXY UNKNOWN\r\n"},
+		{"v2 IPv4", 2, v4, signature + "\x21\x11\x00\x0c" +
+			"\xc0\x00\x02\x01" + "\xc6\x33\x64\x02" + "\xc3\x50" + "\x00\x16"},
+		{"v2 IPv6", 2, v6, signature + "\x21\x21\x00\x24" +
+			"\x20\x01\x0d\xb8" + "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" +
+			"\x20\x01\x0d\xb8" + "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02" +
+			"\xc3\x50" + "\x00\x16"},
+		{"v2 mixed", 2, mixed, signature + "\x21\x21\x00\x24" +
+			"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xff\xff" + "\xc0\x00\x02\x01" +
+			"\x20\x01\x0d\xb8" + "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02" +
+			"\xc3\x50" + "\x00\x16"},
+		{"v2 unknown", 2, unix, signature + "\x20\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := proxyProtocolHeader(tt.version, tt.conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := proxyProtocolHeader(3, v4); err == nil {
+		t.Error("version 3 didn't fail")
+	}
+}
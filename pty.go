@@ -0,0 +1,116 @@
+package simplessh
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// A PTY is a pseudo-terminal requested for a command, see WithPTY. Its size
+// can change while the command runs, either with Resize or by following a
+// local terminal with WatchTerminal, and the remote program is told so it
+// redraws full-screen output correctly.
+type PTY struct {
+	// Term is the value of $TERM on the remote host, "xterm-256color" if
+	// empty.
+	Term string
+
+	// Modes are the terminal modes to request, echo on and 14400 baud if
+	// nil.
+	Modes ssh.TerminalModes
+
+	mu       sync.Mutex
+	width    int
+	height   int
+	sessions map[*ssh.Session]struct{}
+}
+
+// NewPTY returns a PTY of width columns and height rows.
+func NewPTY(width, height int) *PTY {
+	return &PTY{width: width, height: height}
+}
+
+// WithPTY runs the command with pty attached. Servers send stderr merged into
+// stdout when there's a pseudo-terminal.
+func WithPTY(pty *PTY) ExecOption {
+	return func(o *execOptions) {
+		o.pty = pty
+	}
+}
+
+// Size returns the PTY's current width and height.
+func (p *PTY) Size() (width, height int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.width, p.height
+}
+
+// Resize changes the PTY's size and sends a window-change request to the
+// commands it's attached to.
+func (p *PTY) Resize(width, height int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if width == p.width && height == p.height {
+		return nil
+	}
+	p.width, p.height = width, height
+
+	var firstErr error
+	for session := range p.sessions {
+		if err := session.WindowChange(height, width); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WatchTerminal makes the PTY follow the size of the local terminal fd, such
+// as int(os.Stdout.Fd()), until stop is called.
+func (p *PTY) WatchTerminal(fd int) (stop func()) {
+	resize := func() {
+		if width, height, err := term.GetSize(fd); err == nil {
+			p.Resize(width, height)
+		}
+	}
+	resize()
+
+	return watchResize(resize)
+}
+
+// request asks for the pseudo-terminal on session and attaches the PTY to it
+// until the returned function is called.
+func (p *PTY) request(session *ssh.Session) (func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name := p.Term
+	if name == "" {
+		name = "xterm-256color"
+	}
+	modes := p.Modes
+	if modes == nil {
+		modes = ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+	}
+
+	if err := session.RequestPty(name, p.height, p.width, modes); err != nil {
+		return nil, err
+	}
+
+	if p.sessions == nil {
+		p.sessions = make(map[*ssh.Session]struct{})
+	}
+	p.sessions[session] = struct{}{}
+
+	return func() {
+		p.mu.Lock()
+		delete(p.sessions, session)
+		p.mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package simplessh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchResize calls resize whenever the process gets SIGWINCH.
+func watchResize(resize func()) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				resize()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
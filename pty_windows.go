@@ -0,0 +1,28 @@
+//go:build windows
+
+package simplessh
+
+import "time"
+
+// watchResize calls resize periodically since Windows consoles don't signal
+// size changes, resize only acts when the size actually changed.
+func watchResize(resize func()) (stop func()) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				resize()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
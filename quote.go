@@ -0,0 +1,66 @@
+package simplessh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Quote returns s quoted so a POSIX shell reads it as a single word with no
+// expansion. Words made of safe characters only are returned as is.
+func Quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteArgs quotes every argument with Quote and joins them with spaces.
+func QuoteArgs(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Raw is a piece of shell syntax, such as a pipe or a redirection, that
+// Quotef and Execf insert as is instead of quoting.
+type Raw string
+
+// Quotef formats like fmt.Sprintf but quotes every argument with Quote after
+// formatting it, so values can be interpolated into a command without being
+// able to inject shell syntax. Arguments of type Raw aren't quoted.
+//
+//	cmd := simplessh.Quotef("grep -c %s %s", pattern, path)
+func Quotef(format string, args ...any) string {
+	return quotef(Quote, format, args...)
+}
+
+// Execf runs the command c.Quotef returns for format and args, see Exec.
+func (c *Client) Execf(format string, args ...any) ([]byte, error) {
+	return c.Exec(c.Quotef(format, args...))
+}
+
+func quotef(quote func(string) string, format string, args ...any) string {
+	quoted := make([]any, len(args))
+	for i, arg := range args {
+		if raw, ok := arg.(Raw); ok {
+			quoted[i] = string(raw)
+			continue
+		}
+		quoted[i] = quotedArg{v: arg, quote: quote}
+	}
+	return fmt.Sprintf(format, quoted...)
+}
+
+// quotedArg formats its value with the verb it's used with and quotes the
+// result.
+type quotedArg struct {
+	v     any
+	quote func(string) string
+}
+
+func (a quotedArg) Format(f fmt.State, verb rune) {
+	io.WriteString(f, a.quote(fmt.Sprintf(fmt.FormatString(f, verb), a.v)))
+}
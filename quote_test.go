@@ -0,0 +1,77 @@
+package simplessh
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+var quoteTests = []struct {
+	s    string
+	want string
+}{
+	{"", "''"},
+	{"plain", "plain"},
+	{"/srv/app-1.2/config_v2.yml", "/srv/app-1.2/config_v2.yml"},
+	{"user@host:22,a=b+c%d", "user@host:22,a=b+c%d"},
+	{"two words", "'two words'"},
+	{"it's", `'it'\''s'`},
+	{"'", `''\'''`},
+	{"$HOME", "'$HOME'"},
+	{"$(rm -rf /)", "'$(rm -rf /)'"},
+	{"`id`", "'`id`'"},
+	{"a;b|c&d", "'a;b|c&d'"},
+	{"*.log", "'*.log'"},
+	{"~root", "'~root'"},
+	{`back\slash`, `'back\slash'`},
+	{"line\nbreak", "'line\nbreak'"},
+	{"-n", "-n"},
+}
+
+func TestQuote(t *testing.T) {
+	for _, tt := range quoteTests {
+		if got := Quote(tt.s); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no POSIX shell")
+	}
+	for _, tt := range quoteTests {
+		out, err := exec.Command("sh", "-c", "printf %s "+Quote(tt.s)).Output()
+		if err != nil {
+			t.Fatalf("sh -c printf %%s %s: %v", Quote(tt.s), err)
+		}
+		if string(out) != tt.s {
+			t.Errorf("sh read %s as %q, want %q", Quote(tt.s), out, tt.s)
+		}
+	}
+}
+
+func TestQuotef(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []any
+		want   string
+	}{
+		{"rm -f %s", []any{"a b"}, "rm -f 'a b'"},
+		{"grep -c %s %s", []any{"x;y", "/var/log/app.log"}, "grep -c 'x;y' /var/log/app.log"},
+		{"head -n %d %s", []any{10, "f"}, "head -n 10 f"},
+		{"echo %5d", []any{42}, "echo '   42'"},
+		{"echo %q", []any{"it's"}, `echo '"it'\''s"'`},
+		{"echo %v", []any{[]string{"a", "b"}}, "echo '[a b]'"},
+		{"ls %s %s", []any{Raw("| wc -l"), "d"}, "ls | wc -l d"},
+	}
+	for _, tt := range tests {
+		if got := Quotef(tt.format, tt.args...); got != tt.want {
+			t.Errorf("Quotef(%q, %v) = %s, want %s", tt.format, tt.args, got, tt.want)
+		}
+	}
+
+	if got, want := QuoteArgs("cp", "-r", "my dir", "$dest"), "cp -r 'my dir' '$dest'"; got != want {
+		t.Errorf("QuoteArgs = %s, want %s", got, want)
+	}
+}
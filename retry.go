@@ -0,0 +1,184 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A RetryPolicy retries operations that fail with transient errors, waiting
+// longer after every failed attempt. The zero value makes a single attempt.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first one.
+	Attempts int
+
+	// InitialBackoff is the wait after the first failure, 1 second if zero.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts, 30 seconds if zero.
+	MaxBackoff time.Duration
+
+	// Multiplier grows the wait after every failure, 2 if zero.
+	Multiplier float64
+
+	// Jitter randomizes each wait by up to this fraction of it, so clients
+	// failing together don't retry in lockstep. 0.2 spreads waits by ±20%.
+	Jitter float64
+
+	// Retryable decides which errors are worth another attempt, IsTransient
+	// if nil.
+	Retryable func(error) bool
+}
+
+// WithRetry retries establishing the connection according to policy. Each
+// attempt gets the full timeout, and the context of WithConnectContext being
+// done stops the wait for the next one.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithExecRetry runs the command again according to policy when it fails with
+// a transient error, such as the connection dropping before the command
+// finished. Only use it for commands that are safe to run more than once.
+// Output of failed attempts is discarded. The context of WithCommandContext
+// being done stops the wait for the next attempt.
+func WithExecRetry(policy RetryPolicy) ExecOption {
+	return func(o *execOptions) {
+		o.retry = policy
+	}
+}
+
+// WithTransferRetry transfers the file again according to policy when it
+// fails with a transient error, such as the connection dropping part way.
+// Every attempt starts over from the beginning of the file.
+func WithTransferRetry(policy RetryPolicy) TransferOption {
+	return func(o *transferOptions) {
+		o.retry = policy
+	}
+}
+
+// WithExecRetryOnExit runs the command again according to policy when it
+// exits with one of codes, such as 75 (EX_TEMPFAIL) or 100 for apt-get
+// failing to get the dpkg lock, as well as when policy's Retryable says so.
+// Like WithExecRetry, only use it for commands that are safe to run more than
+// once.
+func WithExecRetryOnExit(policy RetryPolicy, codes ...int) ExecOption {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	policy.Retryable = func(err error) bool {
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) && exitErr.Signal == "" && slices.Contains(codes, exitErr.Status) {
+			return true
+		}
+		return retryable(err)
+	}
+	return WithExecRetry(policy)
+}
+
+// Do calls fn until it succeeds, returns an error that isn't retryable or the
+// attempts run out, returning the last error. It can be used to retry
+// operations that don't take a RetryPolicy:
+//
+//	err := policy.Do(func() error {
+//		_, err := client.SyncDir(localDir, remoteDir)
+//		return err
+//	})
+func (p RetryPolicy) Do(fn func() error) error {
+	return p.do(context.Background(), fn)
+}
+
+// do is Do, stopping the wait between attempts when ctx is done.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !retryable(err) {
+			return err
+		}
+
+		wait := backoff
+		if p.Jitter > 0 {
+			wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(wait))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		backoff = time.Duration(float64(backoff) * multiplier)
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// IsTransient reports whether err looks like a network failure that may go
+// away on its own: timeouts, refused or reset connections, unreachable hosts
+// and connections closed unexpectedly. Authentication and host key failures
+// and commands that exited with a status aren't transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, permanent := range []error{ErrAuthFailed, ErrHostKeyMismatch, ErrUnknownHost, ErrCommandTimeout, ErrCircuitOpen, ErrCommandDenied, ErrNoSuchDirectory, ErrBecomeFailed} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+
+	if errors.Is(err, ErrConnectTimeout) {
+		return true
+	}
+	// The caller gave up, trying again won't help.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	for _, errno := range []syscall.Errno{syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EHOSTUNREACH, syscall.ENETUNREACH, syscall.EPIPE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	var missing *ssh.ExitMissingError
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &missing)
+}
@@ -0,0 +1,36 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{Attempts: 3, InitialBackoff: time.Hour}
+
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- policy.do(ctx, func() error {
+			attempts++
+			return syscall.ECONNREFUSED
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("do error = %v, want context.Canceled", err)
+		}
+		if attempts != 1 {
+			t.Errorf("made %d attempts, want 1", attempts)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("do kept waiting after the context was cancelled")
+	}
+}
@@ -0,0 +1,114 @@
+package simplessh
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// ScriptDir is the remote directory RunScript uploads scripts to.
+var ScriptDir = "/tmp"
+
+// WithInterpreter runs scripts passed to RunScript with interpreter, such as
+// "bash -e" or "python3", instead of executing them directly, which needs a
+// #! line. The interpreter is used as is, so it can include flags.
+func WithInterpreter(interpreter string) ExecOption {
+	return func(o *execOptions) {
+		o.interpreter = interpreter
+	}
+}
+
+// RunScript uploads the local script at path to a temporary file on the
+// remote host, runs it with args and returns its stdout and stderr combined.
+// The temporary file is removed afterwards even if the script failed. On
+// Windows hosts, see WithRemotePlatform, the script is uploaded to the home
+// directory and must be a batch file or, with WindowsPowerShell, a
+// PowerShell script.
+func (c *Client) RunScript(path string, args []string, opts ...ExecOption) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return c.runScript(path, f, args, opts)
+}
+
+// RunScriptReader is like RunScript but reads the script from r.
+func (c *Client) RunScriptReader(r io.Reader, args []string, opts ...ExecOption) ([]byte, error) {
+	return c.runScript("", r, args, opts)
+}
+
+func (c *Client) runScript(local string, r io.Reader, args []string, opts []ExecOption) (_ []byte, err error) {
+	o := newExecOptions(opts)
+	if c.planned(PlannedAction{Kind: "script", Command: c.QuoteArgs(args...), Local: local}) {
+		return nil, nil
+	}
+
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer client.Close()
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	dir, name := ScriptDir, "simplessh-"+hex.EncodeToString(suffix)
+	switch c.platform {
+	case WindowsCmd:
+		name += ".cmd"
+	case WindowsPowerShell:
+		name += ".ps1"
+	}
+	if c.platform.Windows() {
+		if dir, err = client.RealPath("."); err != nil {
+			return nil, err
+		}
+	}
+	remote := path.Join(dir, name)
+
+	file, err := client.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create %s: %w", remote, err)
+	}
+	defer func() {
+		if removeErr := client.Remove(remote); removeErr != nil && err == nil {
+			err = fmt.Errorf("Couldn't remove %s: %w", remote, removeErr)
+		}
+	}()
+
+	if !c.platform.Windows() {
+		if err := file.Chmod(0700); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	script := remote
+	if c.platform.Windows() {
+		script = windowsPath(remote)
+	}
+	cmd := c.QuoteArgs(append([]string{script}, args...)...)
+	switch {
+	case o.interpreter != "":
+		cmd = o.interpreter + " " + cmd
+	case c.platform == WindowsPowerShell:
+		// A quoted string is only run as a command with the call operator.
+		cmd = "& " + cmd
+	}
+
+	return c.Exec(cmd, opts...)
+}
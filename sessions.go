@@ -0,0 +1,239 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// A SessionLimitPolicy decides what happens to an operation needing a session
+// when the connection already has as many open as WithMaxSessions allows.
+type SessionLimitPolicy int
+
+const (
+	// SessionLimitWait waits for another session to close.
+	SessionLimitWait SessionLimitPolicy = iota
+
+	// SessionLimitFail returns an error wrapping ErrTooManySessions.
+	SessionLimitFail
+)
+
+// WithMaxSessions limits how many sessions the Client opens at once on the
+// connection. Each command, shell and SFTP operation takes a session, and
+// servers refuse sessions beyond their own limit, such as MaxSessions in
+// OpenSSH's sshd_config which defaults to 10, so goroutines sharing a Client
+// can set this to stay under it. Sessions opened with NewSession and
+// SFTPClient aren't counted.
+//
+// Without it, or with n of 0, the limit is learned from the server: when it
+// refuses a session while others are open, the number open is taken as its
+// limit and the operations beyond it are handled by policy, waiting by
+// default.
+func WithMaxSessions(n int, policy SessionLimitPolicy) Option {
+	return func(o *options) {
+		o.maxSessions, o.sessionLimit = n, policy
+	}
+}
+
+// WithSpillConnections lets the Client open up to n more connections to the
+// host, authenticating the same way, when all the sessions the first one can
+// carry are in use. The additional connections stay open until the Client is
+// closed.
+func WithSpillConnections(n int) Option {
+	return func(o *options) {
+		o.spillConns = n
+	}
+}
+
+// sessionPool counts the open sessions of a Client's connections.
+type sessionPool struct {
+	policy   SessionLimitPolicy
+	limit    int
+	maxConns int
+	// dial opens another connection for spilling sessions.
+	dial func() (*ssh.Client, error)
+
+	mu      sync.Mutex
+	conns   []*pooledConn
+	dialing int
+	// freed is closed and replaced when a session closes.
+	freed chan struct{}
+}
+
+// A pooledConn is a connection of a sessionPool.
+type pooledConn struct {
+	client *ssh.Client
+	limit  int
+	open   int
+}
+
+func newSessionPool(client *ssh.Client, limit int, policy SessionLimitPolicy, spill int) *sessionPool {
+	return &sessionPool{
+		policy:   policy,
+		limit:    limit,
+		maxConns: 1 + max(spill, 0),
+		conns:    []*pooledConn{{client: client, limit: limit}},
+		freed:    make(chan struct{}),
+	}
+}
+
+// acquire takes a session on one of the connections, opening another one or
+// waiting for a session to close if they're all at their limit.
+func (p *sessionPool) acquire(ctx context.Context) (*pooledConn, error) {
+	for {
+		p.mu.Lock()
+		for _, conn := range p.conns {
+			if conn.limit <= 0 || conn.open < conn.limit {
+				conn.open++
+				p.mu.Unlock()
+				return conn, nil
+			}
+		}
+
+		if p.dial != nil && len(p.conns)+p.dialing < p.maxConns {
+			p.dialing++
+			p.mu.Unlock()
+			client, err := p.dial()
+
+			p.mu.Lock()
+			p.dialing--
+			if err != nil {
+				p.mu.Unlock()
+				return nil, fmt.Errorf("Couldn't open another connection: %w", err)
+			}
+			conn := &pooledConn{client: client, limit: p.limit, open: 1}
+			p.conns = append(p.conns, conn)
+			p.mu.Unlock()
+			return conn, nil
+		}
+
+		limit, freed := p.conns[0].limit, p.freed
+		p.mu.Unlock()
+
+		if p.policy == SessionLimitFail {
+			return nil, fmt.Errorf("%w: %d sessions open", ErrTooManySessions, limit)
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *sessionPool) release(conn *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn.open--
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// refused takes a session the server refused to open on conn as its limit,
+// if other sessions are open on conn, and reports whether it did. conn's
+// session has been released.
+func (p *sessionPool) refused(conn *pooledConn, err error) (int, bool) {
+	var openErr *ssh.OpenChannelError
+	if !errors.As(err, &openErr) || openErr.Reason != ssh.Prohibited {
+		return 0, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conn.open == 0 {
+		// The server doesn't want any sessions.
+		return 0, false
+	}
+	if conn.limit <= 0 || conn.open < conn.limit {
+		conn.limit = conn.open
+	}
+	return conn.limit, true
+}
+
+// close closes the additional connections.
+func (p *sessionPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, conn := range p.conns[1:] {
+		conn.client.Close()
+	}
+	p.conns = p.conns[:1]
+}
+
+// session opens a session counted against the session limit. release has to
+// be called once the session is closed.
+func (c *Client) session(ctx context.Context) (*ssh.Session, func(), error) {
+	var session *ssh.Session
+	conn, err := c.acquireSession(ctx, func(client *ssh.Client) (err error) {
+		session, err = c.newSession(client)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, func() { c.sessions.release(conn) }, nil
+}
+
+// sftpClient starts an SFTP client counted against the session limit.
+// release has to be called once the client is closed.
+func (c *Client) sftpClient() (*sftp.Client, func(), error) {
+	var client *sftp.Client
+	conn, err := c.acquireSession(context.Background(), func(sshClient *ssh.Client) (err error) {
+		client, err = newSFTPClient(sshClient)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, func() { c.sessions.release(conn) }, nil
+}
+
+// acquireSession takes a session and opens it with open, taking the
+// sessions open as the server's limit if it's refused.
+func (c *Client) acquireSession(ctx context.Context, open func(*ssh.Client) error) (*pooledConn, error) {
+	for {
+		conn, err := c.sessions.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = open(conn.client)
+		if err == nil {
+			return conn, nil
+		}
+
+		c.sessions.release(conn)
+		limit, ok := c.sessions.refused(conn, err)
+		if !ok {
+			return nil, err
+		}
+		c.log().Debug("Server refused a session, limiting sessions", "limit", limit, "error", err)
+	}
+}
+
+// spill returns the function opening the additional connections of
+// WithSpillConnections.
+func (o *options) spill(c *Client, host string, config *ssh.ClientConfig, timeout time.Duration) func() (*ssh.Client, error) {
+	return func() (*ssh.Client, error) {
+		extra, err := o.dialClient(context.Background(), host, config, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if c.agentForwarding {
+			if err := agent.ForwardToAgent(extra.SSHClient, c.agent); err != nil {
+				extra.SSHClient.Close()
+				return nil, err
+			}
+		}
+		c.log().Info("Opened another connection for sessions")
+		return extra.SSHClient, nil
+	}
+}
@@ -0,0 +1,141 @@
+package simplessh
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"github.com/pkg/sftp"
+)
+
+// VFSStat is the size and usage of a remote file system.
+type VFSStat struct {
+	// Total, Free and Available are in bytes. Available is what's free for
+	// unprivileged users, which excludes the space reserved for root.
+	Total     uint64
+	Free      uint64
+	Available uint64
+
+	Inodes          uint64
+	FreeInodes      uint64
+	AvailableInodes uint64
+}
+
+// StatVFS returns the size and usage of the file system that path is on, for
+// example to check there's enough space before uploading. It needs the
+// statvfs@openssh.com SFTP extension, which OpenSSH supports.
+func (c *Client) StatVFS(path string) (*VFSStat, error) {
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer client.Close()
+	defer c.openChannel("sftp")()
+
+	if _, ok := client.HasExtension("statvfs@openssh.com"); !ok {
+		return nil, fmt.Errorf("Couldn't stat the file system of %s: %w", path, ErrUnsupportedExtension)
+	}
+
+	stat, err := client.StatVFS(c.remotePath(path))
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't stat the file system of %s: %w", path, err)
+	}
+
+	// Block counts are in fragments, which only differ from blocks on some
+	// old file systems.
+	size := stat.Frsize
+	if size == 0 {
+		size = stat.Bsize
+	}
+	return &VFSStat{
+		Total:           stat.Blocks * size,
+		Free:            stat.Bfree * size,
+		Available:       stat.Bavail * size,
+		Inodes:          stat.Files,
+		FreeInodes:      stat.Ffree,
+		AvailableInodes: stat.Favail,
+	}, nil
+}
+
+// Rename renames oldpath to newpath on the remote host, replacing newpath if
+// it exists. The replacement is atomic if the server supports the
+// posix-rename@openssh.com SFTP extension, as OpenSSH does. Otherwise newpath
+// is removed first, leaving a moment when it doesn't exist.
+func (c *Client) Rename(oldpath, newpath string) error {
+	if c.planned(PlannedAction{Kind: "rename", Remote: oldpath + " to " + newpath}) {
+		return nil
+	}
+
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer client.Close()
+	defer c.openChannel("sftp")()
+
+	return c.rename(client, c.remotePath(oldpath), c.remotePath(newpath))
+}
+
+func (c *Client) rename(client *sftp.Client, oldpath, newpath string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(oldpath, newpath)
+	}
+
+	// Plain SFTP renames fail if newpath exists.
+	err := client.Rename(oldpath, newpath)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := client.Stat(newpath); statErr != nil {
+		return err
+	}
+	c.log().Debug("Server lacks posix-rename, removing the target first", "remote", newpath)
+	if err := client.Remove(newpath); err != nil {
+		return err
+	}
+	return client.Rename(oldpath, newpath)
+}
+
+// atomicTemp returns a temporary name next to remote to upload to before
+// renaming it to remote.
+func atomicTemp(remote string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return path.Join(path.Dir(remote), "."+path.Base(remote)+".simplessh-"+hex.EncodeToString(random)), nil
+}
+
+// Fsync flushes the remote file at path to stable storage, so it survives a
+// crash or power loss of the remote host. It needs the fsync@openssh.com SFTP
+// extension, which OpenSSH supports.
+func (c *Client) Fsync(path string) error {
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer client.Close()
+	defer c.openChannel("sftp")()
+
+	file, err := client.Open(c.remotePath(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.fsync(client, file, path)
+}
+
+func (c *Client) fsync(client *sftp.Client, file *sftp.File, path string) error {
+	if _, ok := client.HasExtension("fsync@openssh.com"); !ok {
+		return fmt.Errorf("Couldn't flush %s: %w", path, ErrUnsupportedExtension)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("Couldn't flush %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// AttachShell starts an interactive shell on the remote host and connects the
+// local terminal to it, the equivalent of running ssh without a command. The
+// terminal is put into raw mode and its size is followed for as long as the
+// shell runs, then restored. It returns when the shell exits or ctx is done,
+// with an *ExitError if the shell exited with a non-zero status.
+func (c *Client) AttachShell(ctx context.Context) error {
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(stdin) {
+		return errors.New("Can't attach a shell, stdin isn't a terminal")
+	}
+	if c.planned(PlannedAction{Kind: "shell"}) {
+		return nil
+	}
+
+	width, height, err := term.GetSize(stdout)
+	if err != nil {
+		width, height = 80, 24
+	}
+	pty := NewPTY(width, height)
+	pty.Term = os.Getenv("TERM")
+
+	session, release, err := c.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer session.Close()
+	defer c.openChannel("session")()
+
+	detach, err := pty.request(session)
+	if err != nil {
+		return err
+	}
+	defer detach()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	state, err := term.MakeRaw(stdin)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(stdin, state)
+
+	stop := pty.WatchTerminal(stdout)
+	defer stop()
+
+	c.log().Info("Attaching shell")
+	if err := session.Shell(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Close()
+		err = ctx.Err()
+	}
+	c.log().Info("Shell detached", "error", err)
+
+	return newExitError("shell", err)
+}
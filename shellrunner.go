@@ -0,0 +1,262 @@
+package simplessh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A ShellRunner runs commands one after the other in a single long-lived
+// shell, so the working directory, variables and functions set by one
+// command are seen by the next and there's no per-command session setup.
+// The output of every command is framed with random markers to tell where it
+// ends and what its exit status was. Commands can't read stdin. A command
+// that exits the shell ends the ShellRunner. Commands go through the same
+// middleware, policies, dry-run mode and audit log as Exec.
+type ShellRunner struct {
+	client  *Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  *frameReader
+	stderr  *frameReader
+	marker  string
+	closed  func()
+
+	mu   sync.Mutex
+	seq  int
+	done chan struct{}
+	err  error
+}
+
+// NewShellRunner starts a POSIX shell on the remote host to run commands in.
+// The ShellRunner must be closed when it's no longer needed.
+func (c *Client) NewShellRunner() (*ShellRunner, error) {
+	if c.platform.Windows() {
+		return nil, errors.New("ShellRunner isn't supported on Windows hosts")
+	}
+
+	session, release, err := c.session(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+
+	if err := session.Start("sh"); err != nil {
+		session.Close()
+		release()
+		return nil, err
+	}
+
+	r := &ShellRunner{
+		client:  c,
+		session: session,
+		stdin:   stdin,
+		stdout:  &frameReader{r: stdout},
+		stderr:  &frameReader{r: stderr},
+		marker:  "__simplessh_" + hex.EncodeToString(random),
+		closed:  c.openChannel("session"),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		r.err = session.Wait()
+		r.closed()
+		release()
+		close(r.done)
+	}()
+
+	return r, nil
+}
+
+// Run runs cmd in the shell and returns its stdout and stderr. As with
+// ExecWithOutputStreams, an *ExitError is returned if cmd exited with a
+// non-zero status.
+func (r *ShellRunner) Run(cmd string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	exec := r.client.chain(func(ctx context.Context, cmd string, stdoutW, stderrW io.Writer) error {
+		return r.run(cmd, stdoutW, stderrW)
+	}, false)
+
+	err := exec(context.Background(), cmd, &stdout, &stderr)
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+func (r *ShellRunner) run(cmd string, stdout, stderr io.Writer) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.client
+	logger := c.log().With("cmd", c.redactedCommand(cmd))
+	logger.Debug("Running command in shell")
+	start := time.Now()
+	defer func() {
+		logCommand(logger, start, err)
+		c.recorder().CommandFinished(c.host, time.Since(start), err)
+		c.audit(cmd, start, err)
+	}()
+
+	select {
+	case <-r.done:
+		return fmt.Errorf("The shell has exited: %w", newExitError("sh", r.err))
+	default:
+	}
+
+	r.seq++
+	marker := r.marker + "_" + strconv.Itoa(r.seq)
+
+	// The braces keep the command in the current shell so its changes stick,
+	// the newline before each marker ends any unterminated last line and is
+	// removed again by frameReader.
+	script := "{\n" + cmd + "\n} </dev/null\n" +
+		"__simplessh_status=$?\n" +
+		"printf '\\n%s %d\\n' " + marker + " $__simplessh_status\n" +
+		"printf '\\n%s\\n' " + marker + " >&2\n"
+	if _, err := io.WriteString(r.stdin, script); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var stderrErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, stderrErr = r.stderr.readFrame(marker, stderr)
+	}()
+	trailer, err := r.stdout.readFrame(marker, stdout)
+	wg.Wait()
+	if err != nil {
+		return r.exited(err)
+	}
+	if stderrErr != nil {
+		return r.exited(stderrErr)
+	}
+
+	status, err := strconv.Atoi(trailer)
+	if err != nil {
+		return fmt.Errorf("Invalid exit status %q from the shell", trailer)
+	}
+	if status != 0 {
+		return &ExitError{Cmd: cmd, Status: status}
+	}
+	return nil
+}
+
+// exited explains a read error caused by the shell exiting.
+func (r *ShellRunner) exited(err error) error {
+	if errors.Is(err, io.EOF) {
+		r.stdin.Close()
+		<-r.done
+		return fmt.Errorf("The shell has exited: %w", newExitError("sh", r.err))
+	}
+	return err
+}
+
+// Close ends the shell.
+func (r *ShellRunner) Close() error {
+	r.stdin.Close()
+	return r.session.Close()
+}
+
+// A frameReader reads a stream of command output framed by markers.
+type frameReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// readFrame copies output to w up to the line "\n<marker>[ trailer]\n" and
+// returns the trailer. Output is held back only as long as it could be the
+// start of the marker line.
+func (f *frameReader) readFrame(marker string, w io.Writer) (string, error) {
+	needle := []byte("\n" + marker)
+	chunk := make([]byte, 32*1024)
+
+	for {
+		if i := bytes.Index(f.buf, needle); i >= 0 {
+			if end := bytes.IndexByte(f.buf[i+len(needle):], '\n'); end >= 0 {
+				w.Write(f.buf[:i])
+				trailer := bytes.TrimSpace(f.buf[i+len(needle) : i+len(needle)+end])
+				f.buf = append(f.buf[:0], f.buf[i+len(needle)+end+1:]...)
+				return string(trailer), nil
+			}
+		} else if keep := len(needle) - 1; len(f.buf) > keep {
+			w.Write(f.buf[:len(f.buf)-keep])
+			f.buf = append(f.buf[:0], f.buf[len(f.buf)-keep:]...)
+		}
+
+		n, err := f.r.Read(chunk)
+		f.buf = append(f.buf, chunk[:n]...)
+		if err != nil && n == 0 {
+			return "", err
+		}
+	}
+}
+
+// A CommandResult is the outcome of one command run by ExecAllInSession.
+type CommandResult struct {
+	Cmd    string
+	Stdout []byte
+	Stderr []byte
+	Err    error
+}
+
+// ExecAllInSession runs cmds one after the other in a single shell session,
+// see ShellRunner, and returns the result of each command that ran. If a
+// command fails the remaining commands are skipped unless keepGoing is set.
+// The error is that of the first command that failed.
+func (c *Client) ExecAllInSession(cmds []string, keepGoing bool) ([]CommandResult, error) {
+	r, err := c.NewShellRunner()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	results := make([]CommandResult, 0, len(cmds))
+	var firstErr error
+	for _, cmd := range cmds {
+		stdout, stderr, err := r.Run(cmd)
+		results = append(results, CommandResult{Cmd: cmd, Stdout: stdout, Stderr: stderr, Err: err})
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !keepGoing {
+			break
+		}
+	}
+
+	return results, firstErr
+}
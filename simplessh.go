@@ -5,208 +5,523 @@
 package simplessh
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net"
 	"os"
 	"os/user"
-	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/sftp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
 const DefaultTimeout = 30 * time.Second
 
+// DefaultPort is the port connected to when the host doesn't specify one and
+// WithDefaultPort isn't given. Change it before connecting in environments
+// that standardize on another port.
+var DefaultPort = "22"
+
+// A Client is a connection to a remote host. It's safe for concurrent use by
+// multiple goroutines: every command and transfer runs in a session of its
+// own, and WithMaxSessions keeps them within the server's limit.
 type Client struct {
 	SSHClient *ssh.Client
+
+	agent           agent.ExtendedAgent
+	agentConn       io.Closer
+	agentForwarding bool
+
+	banner   string
+	logger   *slog.Logger
+	tracer   trace.Tracer
+	metrics  MetricsRecorder
+	auditLog *AuditLog
+	plan     *Plan
+	platform Platform
+	become   *Become
+	host     string
+	user     string
+	port     string
+	closed   atomic.Bool
+	sessions *sessionPool
+
+	transferSummary func(TransferSummary)
+
+	factsMu sync.Mutex
+	facts   *Facts
+
+	mu         sync.Mutex
+	hostKeys   []ssh.PublicKey
+	middleware []ExecMiddleware
+	policies   []*CommandPolicy
+}
+
+// Banner returns the last banner the server sent before authentication, or
+// an empty string if it didn't send one.
+func (c *Client) Banner() string {
+	return c.banner
 }
 
 // Connect with a password. If username is empty simplessh will attempt to get the current user.
-func ConnectWithPassword(host, username, pass string) (*Client, error) {
-	return ConnectWithPasswordTimeout(host, username, pass, DefaultTimeout)
+//
+// In all of the Connect functions host may include the username and port,
+// either as "user@host:port" or as an "ssh://user@host:port" URL. An explicit
+// username argument takes precedence over the one in host. See ParseTarget.
+func ConnectWithPassword(host, username, pass string, opts ...Option) (*Client, error) {
+	return ConnectWithPasswordTimeout(host, username, pass, DefaultTimeout, opts...)
 }
 
 // Same as ConnectWithPassword but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
-func ConnectWithPasswordTimeout(host, username, pass string, timeout time.Duration) (*Client, error) {
+func ConnectWithPasswordTimeout(host, username, pass string, timeout time.Duration, opts ...Option) (*Client, error) {
 	authMethod := ssh.Password(pass)
 
-	return connect(username, host, authMethod, timeout)
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
 }
 
 // Connect with a private key. If privKeyPath is an empty string it will attempt
 // to use $HOME/.ssh/id_rsa. If username is empty simplessh will attempt to get the current user.
-func ConnectWithKeyFileTimeout(host, username, privKeyPath string, timeout time.Duration) (*Client, error) {
-	if privKeyPath == "" {
-		currentUser, err := user.Current()
-		if err == nil {
-			privKeyPath = filepath.Join(currentUser.HomeDir, ".ssh", "id_rsa")
-		}
-	}
-
-	privKey, err := ioutil.ReadFile(privKeyPath)
+func ConnectWithKeyFileTimeout(host, username, privKeyPath string, timeout time.Duration, opts ...Option) (*Client, error) {
+	privKey, err := readKeyFile(privKeyPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return ConnectWithKeyTimeout(host, username, string(privKey), timeout)
+	return ConnectWithKeyTimeout(host, username, string(privKey), timeout, opts...)
 }
 
 // Same as ConnectWithKeyFile but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
-func ConnectWithKeyFile(host, username, privKeyPath string) (*Client, error) {
-	return ConnectWithKeyFileTimeout(host, username, privKeyPath, DefaultTimeout)
+func ConnectWithKeyFile(host, username, privKeyPath string, opts ...Option) (*Client, error) {
+	return ConnectWithKeyFileTimeout(host, username, privKeyPath, DefaultTimeout, opts...)
 }
 
 // Connect with a private key with a custom timeout. If username is empty simplessh will attempt to get the current user.
-func ConnectWithKeyTimeout(host, username, privKey string, timeout time.Duration) (*Client, error) {
-	signer, err := ssh.ParsePrivateKey([]byte(privKey))
+func ConnectWithKeyTimeout(host, username, privKey string, timeout time.Duration, opts ...Option) (*Client, error) {
+	signer, err := ParsePrivateKey([]byte(privKey), "", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	authMethod := ssh.PublicKeys(signer)
+	authMethod := publicKeys(opts, signer)
 
-	return connect(username, host, authMethod, timeout)
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
 }
 
 // Connect with a private key. If username is empty simplessh will attempt to get the current user.
-func ConnectWithKey(host, username, privKey string) (*Client, error) {
-	return ConnectWithKeyTimeout(host, username, privKey, DefaultTimeout)
+func ConnectWithKey(host, username, privKey string, opts ...Option) (*Client, error) {
+	return ConnectWithKeyTimeout(host, username, privKey, DefaultTimeout, opts...)
 }
 
 // Connect with a ssh agent with a custom timeout. If username is empty simplessh will attempt to get the current user.
-func ConnectWithSshAgentTimeout(host, username string, timeout time.Duration) (*Client, error) {
-	sshAgent, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+//
+// The agent is found through SSH_AUTH_SOCK. On Windows, where that is usually
+// unset, the OpenSSH agent's named pipe \\.\pipe\openssh-ssh-agent is used,
+// falling back to Pageant if the OpenSSH agent isn't running.
+//
+// The agent connection is kept open for agent forwarding and closed with the
+// Client. Use ConnectWithAgent to share one agent connection between clients.
+func ConnectWithSshAgentTimeout(host, username string, timeout time.Duration, opts ...Option) (*Client, error) {
+	sshAgent, err := dialAgent()
 	if err != nil {
 		return nil, err
 	}
-	authMethod := ssh.PublicKeysCallback(agent.NewClient(sshAgent).Signers)
-	return connect(username, host, authMethod, timeout)
+	keyring := agent.NewClient(sshAgent)
+	authMethod := publicKeysCallback(opts, agentSigners(keyring))
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, append(opts, withAgent(keyring, sshAgent)))
 }
 
 // Connect with a ssh agent. If username is empty simplessh will attempt to get the current user.
-func ConnectWithSshAgent(host, username string) (*Client, error) {
-	return ConnectWithSshAgentTimeout(host, username, DefaultTimeout)
+func ConnectWithSshAgent(host, username string, opts ...Option) (*Client, error) {
+	return ConnectWithSshAgentTimeout(host, username, DefaultTimeout, opts...)
 }
 
-func connect(username, host string, authMethod ssh.AuthMethod, timeout time.Duration) (*Client, error) {
-	if username == "" {
-		user, err := user.Current()
-		if err != nil {
-			return nil, fmt.Errorf("Username wasn't specified and couldn't get current user: %v", err)
-		}
+// Connect with an agent the caller manages, such as one connection to the
+// local ssh-agent shared by many clients or an in-process agent.NewKeyring.
+// The agent is also used for agent forwarding and is left open by Close. If username is empty simplessh will attempt to get the current user.
+func ConnectWithAgent(host, username string, keyring agent.ExtendedAgent, opts ...Option) (*Client, error) {
+	return ConnectWithAgentTimeout(host, username, keyring, DefaultTimeout, opts...)
+}
 
-		username = user.Username
+// Same as ConnectWithAgent but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithAgentTimeout(host, username string, keyring agent.ExtendedAgent, timeout time.Duration, opts ...Option) (*Client, error) {
+	authMethod := publicKeysCallback(opts, agentSigners(keyring))
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, append(opts, withAgent(keyring, nil)))
+}
+
+// Connect with a ClientConfig built by the caller, for full control over
+// authentication, host key checking and algorithms. config is used as it is,
+// so the options changing it, such as WithHostKeyCallback, WithKnownHosts and
+// WithKeyExchanges, are ignored. If config.User is empty simplessh will
+// attempt to get the current user. A timeout of 0 means DefaultTimeout.
+func ConnectWithConfig(host string, config *ssh.ClientConfig, timeout time.Duration, opts ...Option) (*Client, error) {
+	if config == nil {
+		return nil, errors.New("ClientConfig is required")
 	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	withUser := *config
+	o := newOptions(opts)
+	o.hostKeyTypes = nil
+	return o.connect(host, &withUser, timeout)
+}
 
+func connect(username, host string, authMethods []ssh.AuthMethod, timeout time.Duration, opts []Option) (*Client, error) {
+	o := newOptions(opts)
 	config := &ssh.ClientConfig{
-		User: username,
-		Auth: []ssh.AuthMethod{authMethod},
+		Config:            o.config,
+		User:              username,
+		Auth:              authMethods,
+		HostKeyCallback:   o.hostKeyCallback,
+		HostKeyAlgorithms: o.hostKeyAlgorithms,
+		ClientVersion:     o.clientVersion,
 	}
+	return o.connect(host, config, timeout)
+}
+
+// connect connects to host with config, filling in config.User if it's
+// empty.
+func (o *options) connect(host string, config *ssh.ClientConfig, timeout time.Duration) (_ *Client, err error) {
+	defer func() {
+		// The Client only takes ownership of the agent once it's connected.
+		if err != nil && o.agentConn != nil {
+			o.agentConn.Close()
+		}
+	}()
 
-	host = addPortToHost(host)
+	if o.compression {
+		return nil, errors.New("Compression with zlib@openssh.com isn't supported by golang.org/x/crypto/ssh")
+	}
 
-	conn, err := net.DialTimeout("tcp", host, timeout)
+	target, err := ParseTarget(host)
 	if err != nil {
 		return nil, err
 	}
-	sshConn, chans, reqs, err := ssh.NewClientConn(conn, host, config)
+	username, err := resolveUsername(config.User, target)
 	if err != nil {
 		return nil, err
 	}
-	client := ssh.NewClient(sshConn, chans, reqs)
+	config.User = username
 
-	c := &Client{SSHClient: client}
-	return c, nil
-}
+	host = target.addr(o.port())
+	if o.hostKeyTypes != nil {
+		config.HostKeyAlgorithms = preferHostKeyTypes(config.HostKeyAlgorithms, o.hostKeyTypes(o.hostKeyHostname(host)))
+	}
 
-// Execute cmd on the remote host and return stderr and stdout combined
-func (c *Client) Exec(cmd string) ([]byte, error) {
-	session, err := c.SSHClient.NewSession()
+	logger := o.log().With("host", host, "user", username)
+	logger.Debug("Connecting")
+	start := time.Now()
+
+	ctx, span := startSpan(o.context(), o.tracer, "ssh.connect", hostAttrs(host, username)...)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	var c *Client
+	err = o.retry.do(ctx, func() (err error) {
+		c, err = o.dialClient(ctx, host, config, timeout)
+		if err != nil {
+			logger.Debug("Connection attempt failed", "error", err)
+		}
+		return err
+	})
 	if err != nil {
+		logger.Warn("Connection failed", "error", err, "duration", time.Since(start))
+		o.recorder().ConnectionFailed(host, err)
+		o.connectFailed(host, username, err)
 		return nil, err
 	}
-	defer session.Close()
+	c.logger, c.host, c.user, c.tracer, c.metrics, c.auditLog, c.plan = logger, host, username, o.tracer, o.metrics, o.audit, o.plan
+	if o.spillConns > 0 {
+		c.sessions.dial = o.spill(c, host, config, timeout)
+	}
+
+	if o.forwardAgent {
+		if err := c.forwardAgent(); err != nil {
+			if c.agentConn != o.agentConn {
+				c.agentConn.Close()
+			}
+			c.SSHClient.Close()
+			logger.Warn("Agent forwarding failed", "error", err)
+			o.recorder().ConnectionFailed(host, err)
+			o.connectFailed(host, username, err)
+			return nil, err
+		}
+	}
 
-	return session.CombinedOutput(cmd)
+	logger.Info("Connected", "server_version", string(c.SSHClient.ServerVersion()), "duration", time.Since(start))
+	o.recorder().ConnectionOpened(host)
+	c.watchConnection()
+	o.connected(c)
+	return c, nil
 }
 
-// Execute cmd on the remote host and return stderr and stdout as separte streams
-func (c *Client) ExecWithOutputStreams(cmd string) ([]byte, []byte, error) {
-	session, err := c.SSHClient.NewSession()
+// dialClient makes a single attempt at establishing the connection.
+func (o *options) dialClient(ctx context.Context, host string, config *ssh.ClientConfig, timeout time.Duration) (c *Client, err error) {
+	if o.breaker != nil {
+		if err := o.breaker.allow(host); err != nil {
+			return nil, err
+		}
+		defer func() {
+			o.breaker.record(host, err)
+		}()
+	}
+
+	var banner string
+	withBanner := *config
+	configCallback := config.BannerCallback
+	withBanner.BannerCallback = func(message string) error {
+		banner = message
+		if configCallback != nil {
+			if err := configCallback(message); err != nil {
+				return err
+			}
+		}
+		if o.bannerCallback != nil {
+			return o.bannerCallback(message)
+		}
+		return nil
+	}
+
+	dialTimeout, handshakeTimeout, authTimeout := o.timeouts(timeout)
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	conn, err := o.dialConn(dialCtx, host)
 	if err != nil {
-		return nil, nil, err
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("%w: %w", ErrConnectTimeout, err)
+		}
+		return nil, err
+	}
+	handshakeConfig := &withBanner
+	var traceLogger *slog.Logger
+	if o.trace {
+		traceLogger = o.traceLogger(host)
+		handshakeConfig = traceConfig(handshakeConfig, traceLogger)
 	}
-	defer session.Close()
 
-	var stdout, stderr bytes.Buffer
+	// Closing the connection is the only way to interrupt the handshake.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	sshConn, chans, reqs, err := clientHandshake(conn, host, handshakeConfig, handshakeTimeout, authTimeout)
+	if !stop() {
+		if err == nil {
+			sshConn.Close()
+		}
+		err = ctx.Err()
+	}
+	if err != nil {
+		if traceLogger != nil {
+			traceLogger.Debug("Handshake failed", "error", err)
+		}
+		return nil, err
+	}
+	if traceLogger != nil {
+		sshConn, chans = newTraceConn(sshConn, chans, traceLogger)
+	}
 
-	session.Stdout = &stdout
-	session.Stderr = &stderr
+	c = &Client{banner: banner}
+	if o.hostKeyUpdates {
+		globalReqs := make(chan *ssh.Request)
+		go c.handleGlobalRequests(reqs, globalReqs, sshConn, o.hostKeyHostname(host), o.hostKeysCallback)
+		reqs = globalReqs
+	}
+	o.setupClient(c, ssh.NewClient(sshConn, chans, reqs))
 
-	err = session.Run(cmd)
+	return c, nil
+}
 
-	return stdout.Bytes(), stderr.Bytes(), err
+// setupClient makes c the Client of sshClient, configured by o.
+func (o *options) setupClient(c *Client, sshClient *ssh.Client) {
+	c.SSHClient = sshClient
+	c.agent, c.agentConn = o.agent, o.agentConn
+	c.middleware, c.policies = o.middleware, o.policies
+	c.transferSummary = o.transferSummary
+	c.platform, c.become = o.platform, o.become
+	c.port = o.port()
+	c.sessions = newSessionPool(sshClient, o.maxSessions, o.sessionLimit, o.spillConns)
 }
 
-func (c *Client) Download(remote, local string) error {
-	client, err := sftp.NewClient(c.SSHClient)
-	if err != nil {
+// Execute cmd on the remote host and return stderr and stdout combined
+func (c *Client) Exec(cmd string, opts ...ExecOption) ([]byte, error) {
+	o := newExecOptions(opts)
+
+	var buf *outputBuffer
+	err := o.retry.do(o.context(), func() error {
+		var w io.Writer
+		buf, w = o.combinedOutput()
+		return c.run(cmd, w, w, o)
+	})
+
+	return c.normalizeOutput(buf.Bytes()), o.truncated(cmd, err, buf)
+}
+
+// Execute cmd on the remote host and return stderr and stdout as separte streams
+func (c *Client) ExecWithOutputStreams(cmd string, opts ...ExecOption) ([]byte, []byte, error) {
+	o := newExecOptions(opts)
+
+	stdout, stderr := o.newOutputBuffer(), o.newOutputBuffer()
+	err := o.retry.do(o.context(), func() error {
+		stdout.Reset()
+		stderr.Reset()
+		return c.run(cmd, stdout, stderr, o)
+	})
+
+	return c.normalizeOutput(stdout.Bytes()), c.normalizeOutput(stderr.Bytes()), o.truncated(cmd, err, stdout, stderr)
+}
+
+// Download a remote file to local.
+func (c *Client) Download(remote, local string, opts ...TransferOption) (err error) {
+	o := newTransferOptions(opts)
+
+	_, span := c.startSpan(context.Background(), "ssh.download", attribute.String("ssh.remote_path", remote))
+	var n int64
+	defer func() {
+		span.SetAttributes(attribute.Int64("ssh.bytes", n))
+		endSpan(span, err)
+	}()
+
+	start := time.Now()
+	retries := -1
+	err = o.retry.Do(func() (err error) {
+		retries++
+		n, err = c.download(remote, local, o)
 		return err
+	})
+	c.logTransfer("Download", remote, local, n, start, err)
+	c.transferred("download", remote, local, n, start, retries, err)
+	return err
+}
+
+// download makes a single attempt at downloading remote.
+func (c *Client) download(remote, local string, o *transferOptions) (int64, error) {
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return 0, err
 	}
+	defer release()
 	defer client.Close()
+	defer c.openChannel("sftp")()
 
-	remoteFile, err := client.Open(remote)
+	remoteFile, err := client.Open(c.remotePath(remote))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer remoteFile.Close()
 
 	localFile, err := os.Create(local)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer localFile.Close()
 
-	_, err = io.Copy(localFile, remoteFile)
+	n, err := o.copy(localFile, remoteFile)
+	if err == nil && o.xattrs {
+		err = c.downloadXattrs(remote, local)
+	}
+	return n, err
+}
+
+// Upload a local file to remote.
+func (c *Client) Upload(local, remote string, opts ...TransferOption) (err error) {
+	o := newTransferOptions(opts)
+
+	if c.planned(PlannedAction{Kind: "upload", Local: local, Remote: remote}) {
+		return nil
+	}
+
+	_, span := c.startSpan(context.Background(), "ssh.upload", attribute.String("ssh.remote_path", remote))
+	var n int64
+	defer func() {
+		span.SetAttributes(attribute.Int64("ssh.bytes", n))
+		endSpan(span, err)
+	}()
+
+	start := time.Now()
+	retries := -1
+	err = o.retry.Do(func() (err error) {
+		retries++
+		n, err = c.upload(local, remote, o)
+		return err
+	})
+	c.logTransfer("Upload", remote, local, n, start, err)
+	c.transferred("upload", remote, local, n, start, retries, err)
 	return err
 }
 
-func (c *Client) Upload(local, remote string) error {
-	client, err := sftp.NewClient(c.SSHClient)
+// upload makes a single attempt at uploading local.
+func (c *Client) upload(local, remote string, o *transferOptions) (int64, error) {
+	client, release, err := c.sftpClient()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer release()
 	defer client.Close()
+	defer c.openChannel("sftp")()
 
 	localFile, err := os.Open(local)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer localFile.Close()
 
-	remoteFile, err := client.Create(remote)
+	target := c.remotePath(remote)
+	if o.atomic {
+		if target, err = atomicTemp(target); err != nil {
+			return 0, err
+		}
+	}
+	remoteFile, err := client.Create(target)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = io.Copy(remoteFile, localFile)
-	return err
+	n, err := o.copy(remoteFile, localFile)
+	if err == nil && o.fsync {
+		err = c.fsync(client, remoteFile, remote)
+	}
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && o.xattrs {
+		err = c.uploadXattrs(local, target)
+	}
+	if o.atomic {
+		if err == nil {
+			err = c.rename(client, target, c.remotePath(remote))
+		}
+		if err != nil {
+			client.Remove(target)
+		}
+	}
+	return n, err
 }
 
 // Read a remote file and return the contents.
 func (c *Client) ReadAll(filepath string) ([]byte, error) {
-	sftp, err := c.SFTPClient()
+	sftp, release, err := c.sftpClient()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	defer release()
 	defer sftp.Close()
+	defer c.openChannel("sftp")()
 
-	file, err := sftp.Open(filepath)
+	file, err := sftp.Open(c.remotePath(filepath))
 	if err != nil {
 		return nil, err
 	}
@@ -217,22 +532,67 @@ func (c *Client) ReadAll(filepath string) ([]byte, error) {
 
 // Close the underlying SSH connection
 func (c *Client) Close() error {
+	if c.agentConn != nil {
+		c.agentConn.Close()
+	}
+	c.log().Debug("Closing connection")
+	c.connectionClosed()
+	c.sessions.close()
 	return c.SSHClient.Close()
 }
 
+// Open a new session on the SSH connection, requesting agent forwarding for
+// it when the client was connected with WithAgentForwarding. The session
+// needs to be closed when it's no longer needed.
+func (c *Client) NewSession() (*ssh.Session, error) {
+	return c.newSession(c.SSHClient)
+}
+
+func (c *Client) newSession(client *ssh.Client) (*ssh.Session, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.agentForwarding {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
 // Return an sftp client. The client needs to be closed when it's no
 // longer needed.
 func (c *Client) SFTPClient() (*sftp.Client, error) {
-	return sftp.NewClient(c.SSHClient)
+	return newSFTPClient(c.SSHClient)
 }
 
-func addPortToHost(host string) string {
-	_, _, err := net.SplitHostPort(host)
-
-	// We got an error so blindly try to add a port number
+func newSFTPClient(sshClient *ssh.Client) (*sftp.Client, error) {
+	client, err := sftp.NewClient(sshClient)
 	if err != nil {
-		return net.JoinHostPort(host, "22")
+		return nil, fmt.Errorf("%w: %w", ErrSFTPUnavailable, err)
+	}
+	return client, nil
+}
+
+// resolveUsername picks the explicit username, then the one from the target
+// and finally the current user's.
+func resolveUsername(username string, target Target) (string, error) {
+	if username == "" {
+		username = target.User
+	}
+
+	if username == "" {
+		user, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("Username wasn't specified and couldn't get current user: %v", err)
+		}
+
+		username = user.Username
 	}
 
-	return host
+	return username, nil
 }
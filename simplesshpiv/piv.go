@@ -0,0 +1,167 @@
+// Package simplesshpiv signs with keys held in a YubiKey's PIV slots, so
+// hardware-bound keys can be used with simplessh without going through an
+// ssh-agent.
+//
+//	key, err := simplesshpiv.Open(simplesshpiv.Config{
+//		PINPrompt: func() (string, error) { return readPIN() },
+//		OnTouch:   func() { fmt.Fprintln(os.Stderr, "Touch your YubiKey...") },
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer key.Close()
+//
+//	client, err := simplessh.ConnectWithSigner("host:22", "deploy", key)
+package simplesshpiv
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/go-piv/piv-go/v2/piv"
+)
+
+// Config selects the YubiKey and slot to use.
+type Config struct {
+	// Card is matched against the names of the connected smart cards, the
+	// first YubiKey is used if empty.
+	Card string
+
+	// Slot holding the key, the authentication slot (9a) if zero.
+	Slot piv.Slot
+
+	// PINPrompt is called when the key's PIN policy requires the PIN and it
+	// hasn't been given yet.
+	PINPrompt func() (string, error)
+
+	// OnTouch is called before every signature the YubiKey will wait to be
+	// touched for, so users can be told to touch it.
+	OnTouch func()
+}
+
+// A Key is a crypto.Signer backed by a YubiKey PIV slot. It holds the card
+// open until it's closed.
+type Key struct {
+	yk     *piv.YubiKey
+	signer crypto.Signer
+
+	// TouchPolicy of the slot, zero if the YubiKey's firmware is too old to
+	// report it.
+	TouchPolicy piv.TouchPolicy
+
+	onTouch   func()
+	touchOnce sync.Once
+}
+
+// Open finds the YubiKey and prepares the slot's key for signing.
+func Open(cfg Config) (*Key, error) {
+	card, err := findCard(cfg.Card)
+	if err != nil {
+		return nil, err
+	}
+
+	yk, err := piv.Open(card)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := cfg.Slot
+	if slot == (piv.Slot{}) {
+		slot = piv.SlotAuthentication
+	}
+
+	key, err := open(yk, slot, cfg)
+	if err != nil {
+		yk.Close()
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func open(yk *piv.YubiKey, slot piv.Slot, cfg Config) (*Key, error) {
+	key := &Key{yk: yk, onTouch: cfg.OnTouch}
+
+	var public crypto.PublicKey
+	info, err := yk.KeyInfo(slot)
+	if err == nil {
+		public, key.TouchPolicy = info.PublicKey, info.TouchPolicy
+	} else {
+		// Firmware older than 5.3 can't report key metadata, take the
+		// public key from the slot's certificate instead.
+		cert, err := yk.Certificate(slot)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't get the public key of the slot: %v", err)
+		}
+		public = cert.PublicKey
+	}
+
+	auth := piv.KeyAuth{PINPrompt: cfg.PINPrompt}
+	if cfg.PINPrompt == nil {
+		auth.PINPolicy = piv.PINPolicyNever
+	}
+
+	private, err := yk.PrivateKey(slot, public, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("Slot key can't be used for signing")
+	}
+	key.signer = signer
+
+	return key, nil
+}
+
+func findCard(name string) (string, error) {
+	cards, err := piv.Cards()
+	if err != nil {
+		return "", err
+	}
+
+	for _, card := range cards {
+		if name != "" && strings.Contains(card, name) {
+			return card, nil
+		}
+		if name == "" && strings.Contains(strings.ToLower(card), "yubikey") {
+			return card, nil
+		}
+	}
+
+	if name == "" {
+		return "", errors.New("No YubiKey found")
+	}
+	return "", fmt.Errorf("No smart card matching %q found", name)
+}
+
+// Public returns the slot's public key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// Sign signs digest with the slot's key. With a touch policy of always the
+// OnTouch callback runs before every signature; with a cached policy only
+// before the first one, since the YubiKey remembers the touch for a while.
+func (k *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if k.onTouch != nil {
+		switch k.TouchPolicy {
+		case piv.TouchPolicyAlways:
+			k.onTouch()
+		case piv.TouchPolicyCached:
+			k.touchOnce.Do(k.onTouch)
+		}
+	}
+
+	return k.signer.Sign(rand, digest, opts)
+}
+
+// Close releases the YubiKey.
+func (k *Key) Close() error {
+	return k.yk.Close()
+}
@@ -0,0 +1,82 @@
+// Package simplesshpkcs11 gives simplessh access to private keys held in a
+// PKCS#11 token or HSM, so they never need to exist as files.
+//
+//	token, err := simplesshpkcs11.Open(simplesshpkcs11.Config{
+//		Module:     "/usr/lib/softhsm/libsofthsm2.so",
+//		TokenLabel: "ops",
+//		PIN:        pin,
+//	})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer token.Close()
+//
+//	signer, err := token.Signer(nil, []byte("deploy"))
+//	if err != nil {
+//		panic(err)
+//	}
+//
+//	client, err := simplessh.ConnectWithSigner("host:22", "deploy", signer)
+package simplesshpkcs11
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/ThalesGroup/crypto11"
+)
+
+// Config selects the PKCS#11 module and the token to use.
+type Config struct {
+	// Module is the path of the PKCS#11 shared library.
+	Module string
+
+	// TokenLabel, TokenSerial or SlotNumber select the token. Exactly one of
+	// them must be set.
+	TokenLabel  string
+	TokenSerial string
+	SlotNumber  *int
+
+	// PIN of the token's user.
+	PIN string
+}
+
+// A Token is an open session with a PKCS#11 token.
+type Token struct {
+	ctx *crypto11.Context
+}
+
+// Open loads the module and logs into the token.
+func Open(cfg Config) (*Token, error) {
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:        cfg.Module,
+		TokenLabel:  cfg.TokenLabel,
+		TokenSerial: cfg.TokenSerial,
+		SlotNumber:  cfg.SlotNumber,
+		Pin:         cfg.PIN,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{ctx: ctx}, nil
+}
+
+// Signer returns the key pair with the given CKA_ID and/or CKA_LABEL. Either
+// may be nil but not both. The signer is only usable while the token is open.
+func (t *Token) Signer(id, label []byte) (crypto.Signer, error) {
+	signer, err := t.ctx.FindKeyPair(id, label)
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("No key pair with id %x and label %q on the token", id, label)
+	}
+
+	return signer, nil
+}
+
+// Close logs out of the token and unloads the module.
+func (t *Token) Close() error {
+	return t.ctx.Close()
+}
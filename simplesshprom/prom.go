@@ -0,0 +1,131 @@
+// Package simplesshprom exports what simplessh connections do as Prometheus
+// metrics, so fleet automation built on simplessh can be monitored.
+//
+//	metrics, err := simplesshprom.New(prometheus.DefaultRegisterer)
+//	if err != nil {
+//		panic(err)
+//	}
+//
+//	client, err := simplessh.ConnectWithKeyFile("host:22", "deploy", keyPath,
+//		simplessh.WithMetrics(metrics))
+//
+// Every metric is labeled with the host:port connected to.
+package simplesshprom
+
+import (
+	"errors"
+	"time"
+
+	"github.com/norman-abramovitz/simplessh"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements simplessh.MetricsRecorder with Prometheus collectors.
+// One Metrics is meant to be shared by every connection.
+type Metrics struct {
+	connections     *prometheus.CounterVec
+	connectionsOpen *prometheus.GaugeVec
+	authFailures    *prometheus.CounterVec
+	commands        *prometheus.HistogramVec
+	bytes           *prometheus.CounterVec
+	channelsOpen    *prometheus.GaugeVec
+}
+
+// New creates the metrics and registers them with registerer.
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simplessh_connections_total",
+			Help: "Connection attempts by result: opened, auth_failed, host_key, timeout, circuit_open or error.",
+		}, []string{"host", "result"}),
+		connectionsOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "simplessh_connections_open",
+			Help: "Connections currently open.",
+		}, []string{"host"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simplessh_auth_failures_total",
+			Help: "Connections rejected because authentication failed.",
+		}, []string{"host"}),
+		commands: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "simplessh_command_duration_seconds",
+			Help:    "Duration of commands by result: success, exit_error, timeout or error.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"host", "result"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simplessh_transferred_bytes_total",
+			Help: "Bytes uploaded or downloaded.",
+		}, []string{"host", "direction"}),
+		channelsOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "simplessh_channels_open",
+			Help: "Channels of the connections in use by kind: session, sftp or forward.",
+		}, []string{"host", "kind"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.connections, m.connectionsOpen, m.authFailures, m.commands, m.bytes, m.channelsOpen} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ConnectionOpened counts the connection as opened and open.
+func (m *Metrics) ConnectionOpened(host string) {
+	m.connections.WithLabelValues(host, "opened").Inc()
+	m.connectionsOpen.WithLabelValues(host).Inc()
+}
+
+// ConnectionFailed counts the failed connection attempt by the kind of
+// failure, and authentication failures separately.
+func (m *Metrics) ConnectionFailed(host string, err error) {
+	result := "error"
+	switch {
+	case errors.Is(err, simplessh.ErrAuthFailed):
+		result = "auth_failed"
+		m.authFailures.WithLabelValues(host).Inc()
+	case errors.Is(err, simplessh.ErrHostKeyMismatch), errors.Is(err, simplessh.ErrUnknownHost):
+		result = "host_key"
+	case errors.Is(err, simplessh.ErrConnectTimeout):
+		result = "timeout"
+	case errors.Is(err, simplessh.ErrCircuitOpen):
+		result = "circuit_open"
+	}
+	m.connections.WithLabelValues(host, result).Inc()
+}
+
+// ConnectionClosed counts the connection as no longer open.
+func (m *Metrics) ConnectionClosed(host string) {
+	m.connectionsOpen.WithLabelValues(host).Dec()
+}
+
+// CommandFinished observes the duration of the command by result.
+func (m *Metrics) CommandFinished(host string, duration time.Duration, err error) {
+	var exitErr *simplessh.ExitError
+	result := "success"
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result = "exit_error"
+	case errors.Is(err, simplessh.ErrCommandTimeout):
+		result = "timeout"
+	default:
+		result = "error"
+	}
+	m.commands.WithLabelValues(host, result).Observe(duration.Seconds())
+}
+
+// Transferred counts the bytes transferred by direction.
+func (m *Metrics) Transferred(host, direction string, bytes int64) {
+	m.bytes.WithLabelValues(host, direction).Add(float64(bytes))
+}
+
+// ChannelOpened counts the channel of kind as in use.
+func (m *Metrics) ChannelOpened(host, kind string) {
+	m.channelsOpen.WithLabelValues(host, kind).Inc()
+}
+
+// ChannelClosed counts the channel of kind as no longer in use.
+func (m *Metrics) ChannelClosed(host, kind string) {
+	m.channelsOpen.WithLabelValues(host, kind).Dec()
+}
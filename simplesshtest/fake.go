@@ -0,0 +1,320 @@
+// Package simplesshtest helps test code built on simplessh without a real
+// remote host.
+//
+// Fake is an in-memory simplessh.Clienter with scripted command output and
+// a map of remote files:
+//
+//	fake := simplesshtest.NewFake()
+//	fake.SetOutput("uname -s", "Linux\n", "", 0)
+//	fake.HandleExec(regexp.MustCompile(`^systemctl restart `), func(cmd string) (string, string, int) {
+//		return "", "", 0
+//	})
+//	fake.SetFile("/etc/app.conf", []byte("port=80\n"), 0644)
+//
+//	err := deploy(fake) // deploy takes a simplessh.Clienter
+//
+//	fake.Commands() // the commands deploy ran
+//
+// Server is a real SSH and SFTP server on the loopback interface, for
+// integration tests that need the whole protocol, and VCR records calls to
+// real hosts to replay them later.
+package simplesshtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/norman-abramovitz/simplessh"
+	"github.com/norman-abramovitz/simplessh/internal/lineedit"
+)
+
+// An ExecHandler produces the stdout, stderr and exit status of a command run
+// on a Fake.
+type ExecHandler func(cmd string) (stdout, stderr string, status int)
+
+// Fake implements simplessh.Clienter in memory. Commands get the output set
+// with SetOutput or HandleExec, and file operations work on files set with
+// SetFile or uploaded. Exec and transfer options are ignored. A Fake is safe
+// for concurrent use.
+type Fake struct {
+	// VFS is returned by StatVFS.
+	VFS simplessh.VFSStat
+
+	mu       sync.Mutex
+	outputs  map[string]ExecHandler
+	handlers []fakeHandler
+	files    map[string]*File
+	commands []string
+	closed   bool
+}
+
+type fakeHandler struct {
+	pattern *regexp.Regexp
+	handler ExecHandler
+}
+
+// A File is a file on a Fake.
+type File struct {
+	Content []byte
+	Mode    os.FileMode
+	Owner   string
+	ModTime time.Time
+}
+
+// NewFake returns a Fake with no files that fails every command.
+func NewFake() *Fake {
+	return &Fake{outputs: map[string]ExecHandler{}, files: map[string]*File{}}
+}
+
+var _ simplessh.Clienter = (*Fake)(nil)
+
+// SetOutput makes cmd, matched exactly, produce stdout and stderr and exit
+// with status.
+func (f *Fake) SetOutput(cmd, stdout, stderr string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.outputs[cmd] = func(string) (string, string, int) {
+		return stdout, stderr, status
+	}
+}
+
+// HandleExec runs handler for the commands matching pattern that have no
+// output set with SetOutput. Handlers are tried in the order they were added.
+func (f *Fake) HandleExec(pattern *regexp.Regexp, handler ExecHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.handlers = append(f.handlers, fakeHandler{pattern: pattern, handler: handler})
+}
+
+// SetFile creates or replaces the remote file at path.
+func (f *Fake) SetFile(path string, content []byte, mode os.FileMode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.files[path] = &File{Content: bytes.Clone(content), Mode: mode, ModTime: time.Now()}
+}
+
+// File returns a copy of the remote file at path, or nil if there's none.
+func (f *Fake) File(path string) *File {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[path]
+	if !ok {
+		return nil
+	}
+	copied := *file
+	copied.Content = bytes.Clone(file.Content)
+	return &copied
+}
+
+// Files returns the paths of the remote files, sorted.
+func (f *Fake) Files() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths := make([]string, 0, len(f.files))
+	for path := range f.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Commands returns the commands run so far, in order.
+func (f *Fake) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.commands...)
+}
+
+// Closed reports whether Close was called.
+func (f *Fake) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.closed
+}
+
+// ExecWithOutputStreams runs cmd with the output set for it. Commands that
+// exit with a non-zero status return a *simplessh.ExitError, commands with no
+// output set an error.
+func (f *Fake) ExecWithOutputStreams(cmd string, opts ...simplessh.ExecOption) ([]byte, []byte, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, cmd)
+	handler, ok := f.outputs[cmd]
+	if !ok {
+		for _, h := range f.handlers {
+			if h.pattern.MatchString(cmd) {
+				handler, ok = h.handler, true
+				break
+			}
+		}
+	}
+	f.mu.Unlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("simplesshtest: no output set for command %q", cmd)
+	}
+
+	// The handler runs unlocked so it can use the Fake.
+	stdout, stderr, status := handler(cmd)
+	if status != 0 {
+		return []byte(stdout), []byte(stderr), &simplessh.ExitError{Cmd: cmd, Status: status}
+	}
+	return []byte(stdout), []byte(stderr), nil
+}
+
+// Exec runs cmd like ExecWithOutputStreams and returns stderr after stdout.
+func (f *Fake) Exec(cmd string, opts ...simplessh.ExecOption) ([]byte, error) {
+	stdout, stderr, err := f.ExecWithOutputStreams(cmd, opts...)
+	return append(stdout, stderr...), err
+}
+
+// RunScript runs the script as the command made of its quoted path and
+// arguments. The script has to exist locally.
+func (f *Fake) RunScript(path string, args []string, opts ...simplessh.ExecOption) ([]byte, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return f.Exec(simplessh.QuoteArgs(append([]string{path}, args...)...), opts...)
+}
+
+// Upload stores the content of local as remote.
+func (f *Fake) Upload(local, remote string, opts ...simplessh.TransferOption) error {
+	content, err := os.ReadFile(local)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+
+	f.SetFile(remote, content, info.Mode().Perm())
+	return nil
+}
+
+// Download writes the content of remote to local.
+func (f *Fake) Download(remote, local string, opts ...simplessh.TransferOption) error {
+	content, err := f.ReadAll(remote)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(local, content, 0644)
+}
+
+// ReadAll returns the content of the remote file.
+func (f *Fake) ReadAll(filepath string) ([]byte, error) {
+	file := f.File(filepath)
+	if file == nil {
+		return nil, notExist("open", filepath)
+	}
+	return file.Content, nil
+}
+
+// Rename moves the remote file at oldpath to newpath, replacing newpath.
+func (f *Fake) Rename(oldpath, newpath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[oldpath]
+	if !ok {
+		return notExist("rename", oldpath)
+	}
+	delete(f.files, oldpath)
+	f.files[newpath] = file
+	return nil
+}
+
+// StatVFS returns the VFS field.
+func (f *Fake) StatVFS(path string) (*simplessh.VFSStat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stat := f.VFS
+	return &stat, nil
+}
+
+// EnsureFile sets the remote file unless it already has content, mode and,
+// if not empty, owner, and reports whether it changed it.
+func (f *Fake) EnsureFile(path string, content []byte, mode os.FileMode, owner string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[path]
+	if ok && bytes.Equal(file.Content, content) && file.Mode == mode.Perm() && (owner == "" || file.Owner == owner) {
+		return false, nil
+	}
+	if !ok || !bytes.Equal(file.Content, content) {
+		file = &File{Owner: owner}
+		f.files[path] = file
+	}
+	file.Content, file.Mode, file.ModTime = bytes.Clone(content), mode.Perm(), time.Now()
+	if owner != "" {
+		file.Owner = owner
+	}
+	return true, nil
+}
+
+// UploadTemplate renders tmpl with data as the remote file.
+func (f *Fake) UploadTemplate(tmpl *template.Template, data any, remotePath string, mode os.FileMode) error {
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return err
+	}
+
+	f.SetFile(remotePath, content.Bytes(), mode.Perm())
+	return nil
+}
+
+// LineInFile edits the remote file like simplessh.Client.LineInFile, without
+// the backup.
+func (f *Fake) LineInFile(path, match, line string, ensurePresent bool) (bool, error) {
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[path]
+	if !ok {
+		return false, notExist("open", path)
+	}
+
+	edited := lineedit.Edit(file.Content, re, line, ensurePresent)
+	if bytes.Equal(edited, file.Content) {
+		return false, nil
+	}
+	file.Content, file.ModTime = edited, time.Now()
+	return true, nil
+}
+
+// Close marks the Fake as closed.
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return errors.New("simplesshtest: already closed")
+	}
+	f.closed = true
+	return nil
+}
+
+func notExist(op, path string) error {
+	return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,377 @@
+package simplesshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/norman-abramovitz/simplessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server is an SSH server on the loopback interface for integration tests. It
+// runs commands with a CommandHandler and serves SFTP from a temporary
+// directory:
+//
+//	srv, err := simplesshtest.NewServer(
+//		simplesshtest.WithPassword("deploy", "secret"),
+//		simplesshtest.WithCommandHandler(simplesshtest.Shell))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Close()
+//
+//	client, err := simplessh.ConnectWithPassword(srv.Addr, "deploy", "secret", srv.HostKeyOption())
+type Server struct {
+	// Addr is the host:port the server listens on.
+	Addr string
+
+	// Root is the directory SFTP paths are relative to, removed by Close.
+	// Absolute paths such as /etc/app.conf are in Root too and nothing
+	// outside it can be reached over SFTP.
+	Root string
+
+	// HostKey is the server's host key, generated by NewServer.
+	HostKey ssh.Signer
+
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	handler     CommandHandler
+	maxSessions int
+
+	mu     sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// A ServerOption configures a Server.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	passwords   map[string]string
+	keys        map[string][]ssh.PublicKey
+	handler     CommandHandler
+	maxSessions int
+}
+
+// WithPassword lets user log in with password.
+func WithPassword(user, password string) ServerOption {
+	return func(o *serverOptions) {
+		o.passwords[user] = password
+	}
+}
+
+// WithAuthorizedKey lets user log in with the private key of key.
+func WithAuthorizedKey(user string, key ssh.PublicKey) ServerOption {
+	return func(o *serverOptions) {
+		o.keys[user] = append(o.keys[user], key)
+	}
+}
+
+// WithCommandHandler runs the commands sent to the server with handler. By
+// default every command fails with exit status 127.
+func WithCommandHandler(handler CommandHandler) ServerOption {
+	return func(o *serverOptions) {
+		o.handler = handler
+	}
+}
+
+// WithMaxSessions makes the server refuse more than n sessions at once on a
+// connection, as OpenSSH does with MaxSessions.
+func WithMaxSessions(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxSessions = n
+	}
+}
+
+// A Command is a command run on a Server.
+type Command struct {
+	// User is the user who logged in.
+	User string
+
+	// Cmd is the command line as sent by the client.
+	Cmd string
+
+	// Env is what the client set with env requests, as "key=value".
+	Env []string
+
+	// Root is the Server's Root.
+	Root string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// A CommandHandler runs a command and returns its exit status.
+type CommandHandler func(cmd *Command) int
+
+// Shell is a CommandHandler running commands locally with sh -c, in the
+// Server's Root.
+func Shell(cmd *Command) int {
+	sh := exec.Command("sh", "-c", cmd.Cmd)
+	sh.Dir, sh.Env = cmd.Root, append(os.Environ(), cmd.Env...)
+	sh.Stdout, sh.Stderr = cmd.Stdout, cmd.Stderr
+
+	// Copying stdin through a pipe instead of setting sh.Stdin stops Wait
+	// from waiting for the client to close stdin after sh has exited.
+	stdin, err := sh.StdinPipe()
+	if err != nil {
+		fmt.Fprintln(cmd.Stderr, err)
+		return 255
+	}
+	if err := sh.Start(); err != nil {
+		fmt.Fprintln(cmd.Stderr, err)
+		return 127
+	}
+	go func() {
+		io.Copy(stdin, cmd.Stdin)
+		stdin.Close()
+	}()
+
+	var exitErr *exec.ExitError
+	if err := sh.Wait(); errors.As(err, &exitErr) {
+		if status := exitErr.ExitCode(); status >= 0 {
+			return status
+		}
+		return 255
+	} else if err != nil {
+		fmt.Fprintln(cmd.Stderr, err)
+		return 255
+	}
+	return 0
+}
+
+func notFound(cmd *Command) int {
+	fmt.Fprintf(cmd.Stderr, "simplesshtest: no command handler for %q\n", cmd.Cmd)
+	return 127
+}
+
+// NewServer starts a Server on a random port of 127.0.0.1. Nobody can log in
+// without WithPassword or WithAuthorizedKey.
+func NewServer(opts ...ServerOption) (*Server, error) {
+	o := &serverOptions{passwords: map[string]string{}, keys: map[string][]ssh.PublicKey{}, handler: notFound}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			want, ok := o.passwords[meta.User()]
+			if ok && subtle.ConstantTimeCompare([]byte(want), password) == 1 {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("simplesshtest: wrong password for %s", meta.User())
+		},
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authorized := range o.keys[meta.User()] {
+				if subtle.ConstantTimeCompare(authorized.Marshal(), key.Marshal()) == 1 {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("simplesshtest: key not authorized for %s", meta.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	root, err := os.MkdirTemp("", "simplesshtest")
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:        listener.Addr().String(),
+		Root:        root,
+		HostKey:     hostKey,
+		listener:    listener,
+		config:      config,
+		handler:     o.handler,
+		maxSessions: o.maxSessions,
+		conns:       map[net.Conn]bool{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// HostKeyOption returns the Option making a client accept the Server's host
+// key.
+func (s *Server) HostKeyOption() simplessh.Option {
+	return simplessh.WithHostKeyCallback(ssh.FixedHostKey(s.HostKey.PublicKey()))
+}
+
+// Close stops the server, closes the connections to it and removes Root.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("simplesshtest: server already closed")
+	}
+	s.closed = true
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return errors.Join(err, os.RemoveAll(s.Root))
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	var sessions sync.WaitGroup
+	defer sessions.Wait()
+	var mu sync.Mutex
+	open := 0
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		mu.Lock()
+		if s.maxSessions > 0 && open >= s.maxSessions {
+			mu.Unlock()
+			newChannel.Reject(ssh.Prohibited, "open failed")
+			continue
+		}
+		open++
+		mu.Unlock()
+		closed := func() {
+			mu.Lock()
+			open--
+			mu.Unlock()
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			closed()
+			continue
+		}
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			s.handleSession(sshConn.User(), channel, requests, closed)
+		}()
+	}
+}
+
+// handleSession serves a session until its command or SFTP has finished,
+// calling closed before closing the channel.
+func (s *Server) handleSession(user string, channel ssh.Channel, requests <-chan *ssh.Request, closed func()) {
+	defer channel.Close()
+	defer closed()
+
+	var env []string
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &kv); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			env = append(env, kv.Name+"="+kv.Value)
+			req.Reply(true, nil)
+
+		case "pty-req", "window-change":
+			req.Reply(req.Type == "pty-req", nil)
+
+		case "exec":
+			var payload struct{ Cmd string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			status := s.handler(&Command{
+				User:   user,
+				Cmd:    payload.Cmd,
+				Env:    env,
+				Root:   s.Root,
+				Stdin:  channel,
+				Stdout: channel,
+				Stderr: channel.Stderr(),
+			})
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			s.serveSFTP(channel)
+			return
+
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package simplesshtest_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/norman-abramovitz/simplessh"
+	"github.com/norman-abramovitz/simplessh/simplesshtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func newServer(t *testing.T, opts ...simplesshtest.ServerOption) *simplesshtest.Server {
+	t.Helper()
+	srv, err := simplesshtest.NewServer(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func connect(t *testing.T, srv *simplesshtest.Server) *simplessh.Client {
+	t.Helper()
+	client, err := simplessh.ConnectWithPassword(srv.Addr, "deploy", "secret", srv.HostKeyOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell needs sh")
+	}
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"), simplesshtest.WithCommandHandler(simplesshtest.Shell))
+	client := connect(t, srv)
+
+	output, err := client.Exec("echo hello; pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(srv.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(output), "hello\n"+root+"\n"; got != want {
+		t.Errorf("Exec output = %q, want %q", got, want)
+	}
+
+	stdout, stderr, err := client.ExecWithOutputStreams("echo out; echo err >&2; exit 3")
+	var exitErr *simplessh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Status != 3 {
+		t.Fatalf("ExecWithOutputStreams error = %v, want exit status 3", err)
+	}
+	if string(stdout) != "out\n" || string(stderr) != "err\n" {
+		t.Errorf("ExecWithOutputStreams = %q, %q, want \"out\\n\", \"err\\n\"", stdout, stderr)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	commands := make(chan *simplesshtest.Command, 1)
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"), simplesshtest.WithCommandHandler(func(cmd *simplesshtest.Command) int {
+		commands <- cmd
+		cmd.Stdout.Write([]byte("handled"))
+		return 0
+	}))
+	client := connect(t, srv)
+
+	output, err := client.Exec("systemctl restart app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "handled" {
+		t.Errorf("Exec output = %q, want handled", output)
+	}
+	got := <-commands
+	if got.User != "deploy" || got.Cmd != "systemctl restart app" || got.Root != srv.Root {
+		t.Errorf("handler got user %q, command %q and root %q", got.User, got.Cmd, got.Root)
+	}
+}
+
+func TestExecWithPrefixedOutput(t *testing.T) {
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"), simplesshtest.WithCommandHandler(func(cmd *simplesshtest.Command) int {
+		cmd.Stdout.Write([]byte("ready\n"))
+		return 0
+	}))
+	host, port, err := net.SplitHostPort(srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := simplessh.ConnectWithPassword(host, "deploy", "secret", srv.HostKeyOption(), simplessh.WithDefaultPort(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var buf bytes.Buffer
+	if err := client.ExecWithPrefixedOutput("status", simplessh.NewPrefixedOutput(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), host+": ready\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestNoCommandHandler(t *testing.T) {
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"))
+	client := connect(t, srv)
+
+	var exitErr *simplessh.ExitError
+	if _, err := client.Exec("true"); !errors.As(err, &exitErr) || exitErr.Status != 127 {
+		t.Errorf("Exec error = %v, want exit status 127", err)
+	}
+}
+
+func TestUploadDownload(t *testing.T) {
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"))
+	client := connect(t, srv)
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "app.conf")
+	content := bytes.Repeat([]byte("listen = 8080\n"), 10000)
+	if err := os.WriteFile(local, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Upload(local, "/app.conf"); err != nil {
+		t.Fatal(err)
+	}
+	uploaded, err := os.ReadFile(filepath.Join(srv.Root, "app.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uploaded, content) {
+		t.Errorf("uploaded %d bytes, want %d", len(uploaded), len(content))
+	}
+
+	downloaded := filepath.Join(dir, "downloaded.conf")
+	if err := client.Download("app.conf", downloaded); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+
+	// Paths leaving Root end up in it.
+	if err := client.Upload(local, "../../escaped.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(srv.Root, "escaped.conf")); err != nil {
+		t.Errorf("upload to ../../escaped.conf isn't in Root: %v", err)
+	}
+
+	if err := client.Download("/missing.conf", filepath.Join(dir, "missing.conf")); err == nil {
+		t.Error("downloading a missing file didn't fail")
+	}
+}
+
+func TestTransferSummary(t *testing.T) {
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"))
+	var summaries []simplessh.TransferSummary
+	client, err := simplessh.ConnectWithPassword(srv.Addr, "deploy", "secret", srv.HostKeyOption(), simplessh.WithTransferSummary(func(s simplessh.TransferSummary) {
+		summaries = append(summaries, s)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := os.WriteFile(filepath.Join(srv.Root, "app.conf"), []byte("listen = 8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The copy succeeds, but there is no getfattr to run on the server.
+	err = client.Download("/app.conf", filepath.Join(t.TempDir(), "app.conf"), simplessh.WithXattrs())
+	if err == nil {
+		t.Fatal("Download with WithXattrs didn't fail")
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(summaries))
+	}
+	if s := summaries[0]; s.Err == nil || s.Err.Error() != err.Error() || s.Bytes != 14 || s.Retries != 0 {
+		t.Errorf("summary = %+v, want the Download error after 14 bytes", s)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"), simplesshtest.WithAuthorizedKey("ci", signer.PublicKey()))
+
+	client, err := simplessh.ConnectWithSigner(srv.Addr, "ci", key, srv.HostKeyOption())
+	if err != nil {
+		t.Fatalf("authorized key: %v", err)
+	}
+	client.Close()
+
+	if client, err := simplessh.ConnectWithSigner(srv.Addr, "ci", otherKey, srv.HostKeyOption()); err == nil {
+		client.Close()
+		t.Error("unknown key was accepted")
+	}
+	if client, err := simplessh.ConnectWithPassword(srv.Addr, "deploy", "wrong", srv.HostKeyOption()); err == nil {
+		client.Close()
+		t.Error("wrong password was accepted")
+	}
+	if client, err := simplessh.ConnectWithPassword(srv.Addr, "ci", "secret", srv.HostKeyOption()); err == nil {
+		client.Close()
+		t.Error("password of another user was accepted")
+	}
+}
+
+func TestHostKeyOption(t *testing.T) {
+	srv := newServer(t, simplesshtest.WithPassword("deploy", "secret"))
+	other := newServer(t)
+
+	client, err := simplessh.ConnectWithPassword(srv.Addr, "deploy", "secret", other.HostKeyOption())
+	if err == nil {
+		client.Close()
+		t.Fatal("another server's host key was accepted")
+	}
+	if !strings.Contains(err.Error(), "host key") {
+		t.Errorf("error = %v, want a host key mismatch", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv, err := simplesshtest.NewServer(simplesshtest.WithPassword("deploy", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := simplessh.ConnectWithPassword(srv.Addr, "deploy", "secret", srv.HostKeyOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(srv.Root); !os.IsNotExist(err) {
+		t.Errorf("Root still exists after Close: %v", err)
+	}
+	if _, err := client.Exec("true"); err == nil {
+		t.Error("Exec after Close didn't fail")
+	}
+	if err := srv.Close(); err == nil {
+		t.Error("second Close didn't fail")
+	}
+}
@@ -0,0 +1,209 @@
+package simplesshtest
+
+import (
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// serveSFTP serves SFTP on channel from the Server's Root.
+func (s *Server) serveSFTP(channel io.ReadWriteCloser) {
+	root, err := os.OpenRoot(s.Root)
+	if err != nil {
+		return
+	}
+	defer root.Close()
+
+	fs := &rootFS{root: root}
+	server := sftp.NewRequestServer(channel, sftp.Handlers{
+		FileGet:  fs,
+		FilePut:  fs,
+		FileCmd:  fs,
+		FileList: fs,
+	})
+	defer server.Close()
+	server.Serve()
+}
+
+// rootFS implements the SFTP request handlers on an os.Root, so that nothing
+// outside it, not even through symlinks, can be reached.
+type rootFS struct {
+	root *os.Root
+}
+
+// name turns an SFTP path into a name in the root.
+func (fs *rootFS) name(p string) string {
+	name := path.Clean("/" + p)[1:]
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (fs *rootFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	return fs.root.Open(fs.name(r.Filepath))
+}
+
+func (fs *rootFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return fs.open(r)
+}
+
+func (fs *rootFS) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	return fs.open(r)
+}
+
+func (fs *rootFS) open(r *sftp.Request) (*os.File, error) {
+	pflags := r.Pflags()
+
+	flags := os.O_RDONLY
+	switch {
+	case pflags.Read && pflags.Write:
+		flags = os.O_RDWR
+	case pflags.Write:
+		flags = os.O_WRONLY
+	}
+	// Appending is left to the client, which writes at the end of the file.
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+
+	mode := os.FileMode(0644)
+	if r.AttrFlags().Permissions {
+		mode = os.FileMode(r.Attributes().Mode).Perm()
+	}
+	return fs.root.OpenFile(fs.name(r.Filepath), flags, mode)
+}
+
+func (fs *rootFS) Filecmd(r *sftp.Request) error {
+	name := fs.name(r.Filepath)
+	switch r.Method {
+	case "Setstat":
+		return fs.setstat(name, r)
+	case "Rename":
+		// SFTP renames don't replace files, PosixRename does.
+		if _, err := fs.root.Lstat(fs.name(r.Target)); err == nil {
+			return os.ErrExist
+		}
+		return fs.root.Rename(name, fs.name(r.Target))
+	case "Rmdir", "Remove":
+		return fs.root.Remove(name)
+	case "Mkdir":
+		return fs.root.Mkdir(name, 0755)
+	case "Link":
+		return fs.root.Link(fs.name(r.Target), name)
+	case "Symlink":
+		// The target is kept as it is, the root resolves it when it's used.
+		return fs.root.Symlink(r.Target, name)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *rootFS) PosixRename(r *sftp.Request) error {
+	return fs.root.Rename(fs.name(r.Filepath), fs.name(r.Target))
+}
+
+func (fs *rootFS) setstat(name string, r *sftp.Request) error {
+	flags, attrs := r.AttrFlags(), r.Attributes()
+
+	if flags.Size {
+		file, err := fs.root.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = file.Truncate(int64(attrs.Size))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := fs.root.Chmod(name, os.FileMode(attrs.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		atime, mtime := time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0)
+		if err := fs.root.Chtimes(name, atime, mtime); err != nil {
+			return err
+		}
+	}
+	if flags.UidGid {
+		return fs.root.Chown(name, int(attrs.UID), int(attrs.GID))
+	}
+	return nil
+}
+
+func (fs *rootFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	name := fs.name(r.Filepath)
+	switch r.Method {
+	case "List":
+		dir, err := fs.root.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer dir.Close()
+		infos, err := dir.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt(infos), nil
+	case "Stat":
+		info, err := fs.root.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	case "Readlink":
+		target, err := fs.root.Readlink(name)
+		if err != nil {
+			return nil, err
+		}
+		info, err := fs.root.Lstat(name)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{linkInfo{FileInfo: info, name: target}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *rootFS) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	info, err := fs.root.Lstat(fs.name(r.Filepath))
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{info}, nil
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(infos []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(infos, l[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// linkInfo is how a Readlink result is returned, as a file named after the
+// link's target.
+type linkInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (l linkInfo) Name() string { return l.name }
@@ -0,0 +1,408 @@
+package simplesshtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"text/template"
+
+	"github.com/norman-abramovitz/simplessh"
+)
+
+// VCR records what a simplessh.Clienter does to a fixture file and replays
+// it, so tests recorded once against real hosts run without them:
+//
+//	var client simplessh.Clienter
+//	if os.Getenv("RECORD") != "" {
+//		real, err := simplessh.ConnectWithKeyFile("host:22", "deploy", keyPath)
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		client = simplesshtest.Record(real, "testdata/deploy.json")
+//	} else {
+//		vcr, err := simplesshtest.Replay("testdata/deploy.json")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		client = vcr
+//	}
+//	defer client.Close()
+//
+// Calls are made one at a time. They're replayed in the order they were
+// recorded and have to be the same calls, with the same commands, paths and
+// uploaded content. Exec and transfer options are passed on when recording
+// but aren't part of the fixture. Errors are replayed with their message,
+// the exit status of commands and the simplessh errors they wrapped, such as
+// simplessh.ErrCommandTimeout.
+type VCR struct {
+	client  simplessh.Clienter
+	fixture string
+
+	mu           sync.Mutex
+	interactions []*interaction
+	next         int
+	closed       bool
+}
+
+// An interaction is a recorded call.
+type interaction struct {
+	Op      string             `json:"op"`
+	Args    []string           `json:"args,omitempty"`
+	Stdout  []byte             `json:"stdout,omitempty"`
+	Stderr  []byte             `json:"stderr,omitempty"`
+	Data    []byte             `json:"data,omitempty"`
+	Changed bool               `json:"changed,omitempty"`
+	VFS     *simplessh.VFSStat `json:"vfs,omitempty"`
+	Error   *recordedError     `json:"error,omitempty"`
+}
+
+type recordedError struct {
+	Message string `json:"message"`
+
+	// Exit is set for commands that failed with a *simplessh.ExitError.
+	Exit *exitStatus `json:"exit,omitempty"`
+
+	// Is names the errors in vcrErrors the error wrapped.
+	Is []string `json:"is,omitempty"`
+}
+
+type exitStatus struct {
+	Cmd    string `json:"cmd"`
+	Status int    `json:"status"`
+	Signal string `json:"signal,omitempty"`
+}
+
+// vcrErrors are the errors that are replayed so that errors.Is finds them.
+var vcrErrors = map[string]error{
+	"AuthFailed":           simplessh.ErrAuthFailed,
+	"HostKeyMismatch":      simplessh.ErrHostKeyMismatch,
+	"UnknownHost":          simplessh.ErrUnknownHost,
+	"ConnectTimeout":       simplessh.ErrConnectTimeout,
+	"CommandTimeout":       simplessh.ErrCommandTimeout,
+	"SFTPUnavailable":      simplessh.ErrSFTPUnavailable,
+	"UnsupportedExtension": simplessh.ErrUnsupportedExtension,
+	"AgentUnavailable":     simplessh.ErrAgentUnavailable,
+	"CircuitOpen":          simplessh.ErrCircuitOpen,
+	"CommandDenied":        simplessh.ErrCommandDenied,
+	"OutputTruncated":      simplessh.ErrOutputTruncated,
+	"NoSuchDirectory":      simplessh.ErrNoSuchDirectory,
+	"BecomeFailed":         simplessh.ErrBecomeFailed,
+	"NotExist":             fs.ErrNotExist,
+	"Exist":                fs.ErrExist,
+	"Permission":           fs.ErrPermission,
+}
+
+func newRecordedError(err error) *recordedError {
+	if err == nil {
+		return nil
+	}
+	recorded := &recordedError{Message: err.Error()}
+	var exitErr *simplessh.ExitError
+	if errors.As(err, &exitErr) {
+		recorded.Exit = &exitStatus{Cmd: exitErr.Cmd, Status: exitErr.Status, Signal: exitErr.Signal}
+	}
+	for name, target := range vcrErrors {
+		if errors.Is(err, target) {
+			recorded.Is = append(recorded.Is, name)
+		}
+	}
+	sort.Strings(recorded.Is)
+	return recorded
+}
+
+func (r *recordedError) error() error {
+	if r == nil {
+		return nil
+	}
+	err := &replayedError{message: r.Message}
+	if r.Exit != nil {
+		err.wrapped = append(err.wrapped, &simplessh.ExitError{Cmd: r.Exit.Cmd, Status: r.Exit.Status, Signal: r.Exit.Signal})
+	}
+	for _, name := range r.Is {
+		if target, ok := vcrErrors[name]; ok {
+			err.wrapped = append(err.wrapped, target)
+		}
+	}
+	return err
+}
+
+// replayedError is a recorded error, with the recorded message.
+type replayedError struct {
+	message string
+	wrapped []error
+}
+
+func (e *replayedError) Error() string   { return e.message }
+func (e *replayedError) Unwrap() []error { return e.wrapped }
+
+// Record returns a VCR passing calls on to client and recording them. Close
+// writes them to fixture and closes client.
+func Record(client simplessh.Clienter, fixture string) *VCR {
+	return &VCR{client: client, fixture: fixture}
+}
+
+// Replay returns a VCR replaying the calls recorded in fixture.
+func Replay(fixture string) (*VCR, error) {
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		return nil, err
+	}
+	var recorded struct {
+		Interactions []*interaction `json:"interactions"`
+	}
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("simplesshtest: couldn't read fixture %s: %w", fixture, err)
+	}
+	return &VCR{fixture: fixture, interactions: recorded.Interactions}, nil
+}
+
+var _ simplessh.Clienter = (*VCR)(nil)
+
+// Recording reports whether the VCR is recording rather than replaying.
+func (v *VCR) Recording() bool {
+	return v.client != nil
+}
+
+// do records the call made by call, or replays the next interaction after
+// checking it's the same call.
+func (v *VCR) do(op string, args []string, call func(i *interaction) error) (*interaction, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.closed {
+		return nil, errors.New("simplesshtest: VCR closed")
+	}
+
+	if v.Recording() {
+		i := &interaction{Op: op, Args: args}
+		err := call(i)
+		i.Error = newRecordedError(err)
+		v.interactions = append(v.interactions, i)
+		return i, err
+	}
+
+	if v.next >= len(v.interactions) {
+		return nil, fmt.Errorf("simplesshtest: unexpected %s %q, %s has no more calls", op, args, v.fixture)
+	}
+	i := v.interactions[v.next]
+	if i.Op != op || !equalArgs(i.Args, args) {
+		return nil, fmt.Errorf("simplesshtest: unexpected %s %q, %s has %s %q", op, args, v.fixture, i.Op, i.Args)
+	}
+	v.next++
+	return i, i.Error.error()
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Exec runs or replays cmd.
+func (v *VCR) Exec(cmd string, opts ...simplessh.ExecOption) ([]byte, error) {
+	i, err := v.do("exec", []string{cmd}, func(i *interaction) (err error) {
+		i.Stdout, err = v.client.Exec(cmd, opts...)
+		return err
+	})
+	if i == nil {
+		return nil, err
+	}
+	return i.Stdout, err
+}
+
+// ExecWithOutputStreams runs or replays cmd.
+func (v *VCR) ExecWithOutputStreams(cmd string, opts ...simplessh.ExecOption) ([]byte, []byte, error) {
+	i, err := v.do("exec-streams", []string{cmd}, func(i *interaction) (err error) {
+		i.Stdout, i.Stderr, err = v.client.ExecWithOutputStreams(cmd, opts...)
+		return err
+	})
+	if i == nil {
+		return nil, nil, err
+	}
+	return i.Stdout, i.Stderr, err
+}
+
+// RunScript runs or replays the script. The script's content is part of the
+// call.
+func (v *VCR) RunScript(path string, args []string, opts ...simplessh.ExecOption) ([]byte, error) {
+	sum, err := fileSum(path)
+	if err != nil {
+		return nil, err
+	}
+	i, err := v.do("run-script", append([]string{path, sum}, args...), func(i *interaction) (err error) {
+		i.Stdout, err = v.client.RunScript(path, args, opts...)
+		return err
+	})
+	if i == nil {
+		return nil, err
+	}
+	return i.Stdout, err
+}
+
+// Upload uploads local or checks it's what was uploaded when recording.
+func (v *VCR) Upload(local, remote string, opts ...simplessh.TransferOption) error {
+	sum, err := fileSum(local)
+	if err != nil {
+		return err
+	}
+	_, err = v.do("upload", []string{remote, sum}, func(i *interaction) error {
+		return v.client.Upload(local, remote, opts...)
+	})
+	return err
+}
+
+// Download downloads remote, or writes what was downloaded when recording to
+// local.
+func (v *VCR) Download(remote, local string, opts ...simplessh.TransferOption) error {
+	i, err := v.do("download", []string{remote}, func(i *interaction) (err error) {
+		if err := v.client.Download(remote, local, opts...); err != nil {
+			return err
+		}
+		i.Data, err = os.ReadFile(local)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if v.Recording() {
+		return nil
+	}
+	return os.WriteFile(local, i.Data, 0644)
+}
+
+// ReadAll reads or replays the remote file.
+func (v *VCR) ReadAll(filepath string) ([]byte, error) {
+	i, err := v.do("read", []string{filepath}, func(i *interaction) (err error) {
+		i.Data, err = v.client.ReadAll(filepath)
+		return err
+	})
+	if i == nil {
+		return nil, err
+	}
+	return i.Data, err
+}
+
+// Rename renames or replays renaming the remote file.
+func (v *VCR) Rename(oldpath, newpath string) error {
+	_, err := v.do("rename", []string{oldpath, newpath}, func(i *interaction) error {
+		return v.client.Rename(oldpath, newpath)
+	})
+	return err
+}
+
+// StatVFS returns the usage of the remote file system, or what it was when
+// recording.
+func (v *VCR) StatVFS(path string) (*simplessh.VFSStat, error) {
+	i, err := v.do("statvfs", []string{path}, func(i *interaction) (err error) {
+		i.VFS, err = v.client.StatVFS(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if i.VFS == nil {
+		return nil, fmt.Errorf("simplesshtest: statvfs %q in %s has neither a result nor an error", path, v.fixture)
+	}
+	stat := *i.VFS
+	return &stat, nil
+}
+
+// EnsureFile ensures or replays ensuring the remote file's content.
+func (v *VCR) EnsureFile(path string, content []byte, mode os.FileMode, owner string) (bool, error) {
+	args := []string{path, contentSum(content), fmt.Sprintf("%04o", mode.Perm()), owner}
+	i, err := v.do("ensure-file", args, func(i *interaction) (err error) {
+		i.Changed, err = v.client.EnsureFile(path, content, mode, owner)
+		return err
+	})
+	if i == nil {
+		return false, err
+	}
+	return i.Changed, err
+}
+
+// UploadTemplate uploads the rendered template, or checks it renders as it
+// did when recording.
+func (v *VCR) UploadTemplate(tmpl *template.Template, data any, remotePath string, mode os.FileMode) error {
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return err
+	}
+	args := []string{remotePath, contentSum(content.Bytes()), fmt.Sprintf("%04o", mode.Perm())}
+	_, err := v.do("upload-template", args, func(i *interaction) error {
+		return v.client.UploadTemplate(tmpl, data, remotePath, mode)
+	})
+	return err
+}
+
+// LineInFile edits or replays editing the remote file.
+func (v *VCR) LineInFile(path, match, line string, ensurePresent bool) (bool, error) {
+	args := []string{path, match, line, strconv.FormatBool(ensurePresent)}
+	i, err := v.do("line-in-file", args, func(i *interaction) (err error) {
+		i.Changed, err = v.client.LineInFile(path, match, line, ensurePresent)
+		return err
+	})
+	if i == nil {
+		return false, err
+	}
+	return i.Changed, err
+}
+
+// Close stops the VCR. When recording, it closes the client and writes the
+// fixture. When replaying, it returns an error if calls that were recorded
+// weren't made.
+func (v *VCR) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.closed {
+		return errors.New("simplesshtest: VCR already closed")
+	}
+	v.closed = true
+
+	if !v.Recording() {
+		if left := len(v.interactions) - v.next; left > 0 {
+			return fmt.Errorf("simplesshtest: %d recorded calls weren't made, the next is %s %q", left, v.interactions[v.next].Op, v.interactions[v.next].Args)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Interactions []*interaction `json:"interactions"`
+	}{v.interactions}, "", "  ")
+	if err != nil {
+		return errors.Join(err, v.client.Close())
+	}
+	if err := os.MkdirAll(filepath.Dir(v.fixture), 0755); err != nil {
+		return errors.Join(err, v.client.Close())
+	}
+	return errors.Join(os.WriteFile(v.fixture, append(data, '\n'), 0644), v.client.Close())
+}
+
+// fileSum returns the hex-encoded SHA-256 of the local file.
+func fileSum(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return contentSum(content), nil
+}
+
+func contentSum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,148 @@
+package simplessh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+
+	socks5Connect = 0x01
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+
+	socks5Succeeded          = 0x00
+	socks5GeneralFailure     = 0x01
+	socks5HostUnreachable    = 0x04
+	socks5CommandUnsupported = 0x07
+	socks5AddressUnsupported = 0x08
+)
+
+// Run a SOCKS5 proxy on listenAddr that routes every connection through the
+// SSH connection, the equivalent of ssh -D. Only the CONNECT command without
+// authentication is supported, which is what browsers and most tools use.
+// The returned Forwarder must be closed when it's no longer needed.
+func (c *Client) SOCKS5(listenAddr string) (*Forwarder, error) {
+	return newForwarder(c, listenAddr, c.socks5Connect)
+}
+
+// socks5Connect negotiates a SOCKS5 CONNECT request on local and dials the
+// requested address through the SSH connection.
+func (c *Client) socks5Connect(local net.Conn) (net.Conn, error) {
+	local.SetDeadline(time.Now().Add(DefaultTimeout))
+	defer local.SetDeadline(time.Time{})
+
+	addr, err := socks5Handshake(local)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := c.Dial("tcp", addr)
+	if err != nil {
+		socks5Reply(local, socks5HostUnreachable)
+		return nil, err
+	}
+
+	if err := socks5Reply(local, socks5Succeeded); err != nil {
+		remote.Close()
+		return nil, err
+	}
+
+	return remote, nil
+}
+
+// socks5Handshake reads the method selection and the request from conn and
+// returns the requested address as host:port.
+func socks5Handshake(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("Unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socks5NoAcceptable)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+	if method == socks5NoAcceptable {
+		return "", errors.New("SOCKS client doesn't support unauthenticated access")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socks5Version {
+		socks5Reply(conn, socks5GeneralFailure)
+		return "", fmt.Errorf("Unsupported SOCKS version %d in request", request[0])
+	}
+	if request[1] != socks5Connect {
+		socks5Reply(conn, socks5CommandUnsupported)
+		return "", fmt.Errorf("Unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socks5IPv4, socks5IPv6:
+		size := net.IPv4len
+		if request[3] == socks5IPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5Domain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", err
+		}
+		name := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		socks5Reply(conn, socks5AddressUnsupported)
+		return "", fmt.Errorf("Unsupported SOCKS address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socks5Reply sends a reply with the given status. SSH channels don't expose
+// the address they're bound to so an unspecified IPv4 address is reported.
+func socks5Reply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socks5Version, status, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
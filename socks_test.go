@@ -0,0 +1,63 @@
+package simplessh
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSOCKS5Handshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		addr    string
+		reply   []byte
+	}{
+		{"IPv4", []byte{5, 1, 0, 1, 10, 0, 0, 5, 0, 22}, "10.0.0.5:22", nil},
+		{"domain", []byte{5, 1, 0, 3, 4, 'h', 'o', 's', 't', 0x1f, 0x90}, "host:8080", nil},
+		{"bind", []byte{5, 2, 0, 1, 10, 0, 0, 5, 0, 22}, "", []byte{5, socks5CommandUnsupported}},
+		{"address type", []byte{5, 1, 0, 2}, "", []byte{5, socks5AddressUnsupported}},
+		{"version", []byte{4, 1, 0, 1}, "", []byte{5, socks5GeneralFailure}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			type result struct {
+				addr string
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				addr, err := socks5Handshake(server)
+				server.Close()
+				done <- result{addr, err}
+			}()
+
+			client.Write([]byte{5, 1, socks5NoAuth})
+			method := make([]byte, 2)
+			if _, err := io.ReadFull(client, method); err != nil || !bytes.Equal(method, []byte{5, socks5NoAuth}) {
+				t.Fatalf("method selection = %x, %v", method, err)
+			}
+			// The handshake stops reading at the first unsupported field.
+			go client.Write(tt.request)
+			reply, _ := io.ReadAll(client)
+
+			r := <-done
+			if tt.reply == nil {
+				if r.err != nil || r.addr != tt.addr {
+					t.Errorf("socks5Handshake = %q, %v, want %q", r.addr, r.err, tt.addr)
+				}
+				return
+			}
+			if r.err == nil {
+				t.Errorf("socks5Handshake = %q, want an error", r.addr)
+			}
+			if len(reply) < 2 || !bytes.Equal(reply[:2], tt.reply) {
+				t.Errorf("reply = %x, want %x", reply, tt.reply)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// An SRVTarget is a host found in an SRV record.
+type SRVTarget struct {
+	Target
+	Priority uint16
+	Weight   uint16
+}
+
+// LookupSRVTargets returns the hosts listed in the SRV records of name, such
+// as "_ssh._tcp.myfleet.example.com", so inventories can be kept in DNS. They
+// are sorted by priority and randomized by weight within a priority, the
+// order they should be tried in.
+func LookupSRVTargets(ctx context.Context, name string) ([]SRVTarget, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]SRVTarget, 0, len(records))
+	for _, r := range records {
+		// A target of "." means the service isn't available.
+		host := strings.TrimSuffix(r.Target, ".")
+		if host == "" {
+			continue
+		}
+		targets = append(targets, SRVTarget{
+			Target:   Target{Host: host, Port: strconv.Itoa(int(r.Port))},
+			Priority: r.Priority,
+			Weight:   r.Weight,
+		})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("No SRV targets for %s", name)
+	}
+	return targets, nil
+}
+
+// WithSRVLookup looks up the _ssh._tcp SRV records of the host being
+// connected to and dials the hosts they list in order until one connects,
+// falling back to the host itself if it has none. The host key is still
+// checked against the host given to the Connect function.
+func WithSRVLookup() Option {
+	return func(o *options) {
+		o.srvLookup = true
+	}
+}
+
+// dialSRV dials the hosts in the SRV records of host, or host itself if it
+// has none.
+func (o *options) dialSRV(ctx context.Context, host string) (net.Conn, error) {
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+	if _, err := netip.ParseAddr(hostname); err == nil {
+		return o.dial(ctx, "tcp", host)
+	}
+
+	targets, err := LookupSRVTargets(ctx, "_ssh._tcp."+hostname)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return o.dial(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, target := range targets {
+		conn, err := o.dial(ctx, "tcp", target.Addr())
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
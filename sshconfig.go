@@ -0,0 +1,342 @@
+package simplessh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// HostConfig holds the settings ssh_config(5) files specify for a host alias.
+// Only the keywords simplessh knows how to honor are kept.
+type HostConfig struct {
+	// Alias is the name that was looked up.
+	Alias string
+
+	HostName       string
+	User           string
+	Port           string
+	IdentityFiles  []string
+	ConnectTimeout time.Duration
+}
+
+// The files consulted by LookupSSHConfig, in order of precedence. An empty
+// entry for the user file means $HOME/.ssh/config.
+var (
+	UserSSHConfigFile   = ""
+	SystemSSHConfigFile = "/etc/ssh/ssh_config"
+)
+
+// Connect to the host an ssh_config alias resolves to, honoring HostName,
+// User, Port, IdentityFile and ConnectTimeout from $HOME/.ssh/config and
+// /etc/ssh/ssh_config. Authentication is tried with the ssh-agent, if one is
+// running, and then with the identity files, falling back to the default
+// ones in $HOME/.ssh when none are configured.
+func ConnectWithSSHConfig(alias string, opts ...Option) (*Client, error) {
+	hc, err := LookupSSHConfig(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	host := hc.HostName
+	if hc.Port != "" {
+		host = net.JoinHostPort(hc.HostName, hc.Port)
+	}
+
+	timeout := hc.ConnectTimeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	var keyring agent.ExtendedAgent
+	if conn, err := dialAgent(); err == nil {
+		keyring = agent.NewClient(conn)
+		opts = append(opts, withAgent(keyring, conn))
+	}
+
+	authMethod := publicKeysCallback(opts, func() ([]ssh.Signer, error) {
+		return hc.signers(keyring), nil
+	})
+
+	return connect(hc.User, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// LookupSSHConfig resolves alias against the user and system ssh_config
+// files. Missing files are skipped. As with ssh, the first value found for a
+// keyword wins, except for IdentityFile which accumulates.
+func LookupSSHConfig(alias string) (*HostConfig, error) {
+	hc := &HostConfig{Alias: alias}
+
+	home := homeDir()
+	userFile := UserSSHConfigFile
+	if userFile == "" && home != "" {
+		userFile = filepath.Join(home, ".ssh", "config")
+	}
+
+	for _, file := range []string{userFile, SystemSSHConfigFile} {
+		if file == "" {
+			continue
+		}
+		if err := hc.parseFile(file, filepath.Dir(file), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if hc.HostName == "" {
+		hc.HostName = alias
+	}
+	hc.HostName = strings.ReplaceAll(hc.HostName, "%h", alias)
+
+	for i, file := range hc.IdentityFiles {
+		hc.IdentityFiles[i] = hc.expand(file, home)
+	}
+
+	return hc, nil
+}
+
+func (hc *HostConfig) parseFile(path, dir string, depth int) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := hc.parse(f, dir, depth); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func (hc *HostConfig) parse(r io.Reader, dir string, depth int) error {
+	if depth > 16 {
+		return fmt.Errorf("Include nested too deeply")
+	}
+
+	// Settings before the first Host or Match line apply to every host.
+	matching := true
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		keyword, args := splitConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("line %d: %s has no value", line, keyword)
+		}
+
+		switch keyword {
+		case "host":
+			matching = matchHostPatterns(hc.Alias, args)
+			continue
+		case "match":
+			// Only the unconditional form is supported, other criteria
+			// depend on state simplessh doesn't have.
+			matching = len(args) == 1 && strings.EqualFold(args[0], "all")
+			continue
+		}
+
+		if !matching {
+			continue
+		}
+
+		switch keyword {
+		case "include":
+			for _, pattern := range args {
+				if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "~") {
+					pattern = filepath.Join(dir, pattern)
+				}
+				files, err := filepath.Glob(hc.expand(pattern, homeDir()))
+				if err != nil {
+					return fmt.Errorf("line %d: %v", line, err)
+				}
+				for _, file := range files {
+					if err := hc.parseFile(file, dir, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		case "hostname":
+			setOnce(&hc.HostName, args[0])
+		case "user":
+			setOnce(&hc.User, args[0])
+		case "port":
+			setOnce(&hc.Port, args[0])
+		case "identityfile":
+			hc.IdentityFiles = append(hc.IdentityFiles, args[0])
+		case "connecttimeout":
+			if hc.ConnectTimeout == 0 {
+				seconds, err := strconv.Atoi(args[0])
+				if err != nil {
+					return fmt.Errorf("line %d: invalid ConnectTimeout %q", line, args[0])
+				}
+				hc.ConnectTimeout = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// expand replaces a leading ~ and the %d, %u, %h, %r and %% tokens in path.
+func (hc *HostConfig) expand(path, home string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = home + path[1:]
+	}
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	remoteUser := hc.User
+	if remoteUser == "" {
+		remoteUser = localUser
+	}
+
+	return strings.NewReplacer(
+		"%%", "%",
+		"%d", home,
+		"%u", localUser,
+		"%h", hc.HostName,
+		"%r", remoteUser,
+	).Replace(path)
+}
+
+// signers returns the agent's keys, if there is an agent, followed by those
+// from the identity files. Keys that can't be read or are protected by a
+// passphrase are skipped.
+func (hc *HostConfig) signers(keyring agent.ExtendedAgent) []ssh.Signer {
+	var signers []ssh.Signer
+
+	if keyring != nil {
+		if agentSigners, err := agentSigners(keyring)(); err == nil {
+			signers = append(signers, agentSigners...)
+		}
+	}
+
+	files := hc.IdentityFiles
+	if len(files) == 0 {
+		if home := homeDir(); home != "" {
+			for _, name := range []string{"id_rsa", "id_ecdsa", "id_ed25519"} {
+				files = append(files, filepath.Join(home, ".ssh", name))
+			}
+		}
+	}
+
+	return append(signers, loadSigners(files, nil)...)
+}
+
+// splitConfigLine returns the lower-cased keyword and the arguments of an
+// ssh_config line. Keywords may be separated from their arguments by
+// whitespace or a single '=' and arguments may be double quoted.
+func splitConfigLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+
+	var args []string
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] == '#' {
+			break
+		}
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				args = append(args, rest[1:])
+				break
+			}
+			args = append(args, rest[1:end+1])
+			rest = rest[end+2:]
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		args = append(args, rest[:end])
+		rest = rest[end:]
+	}
+
+	return keyword, args
+}
+
+// matchHostPatterns reports whether host matches the patterns of a Host line.
+// A matching negated pattern rules the host out regardless of the others.
+func matchHostPatterns(host string, patterns []string) bool {
+	matched := false
+	for _, field := range patterns {
+		for _, pattern := range strings.Split(field, ",") {
+			negated := strings.HasPrefix(pattern, "!")
+			pattern = strings.TrimPrefix(pattern, "!")
+			if !matchWildcard(strings.ToLower(pattern), strings.ToLower(host)) {
+				continue
+			}
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchWildcard matches s against a pattern where '*' matches any run of
+// characters and '?' matches exactly one.
+func matchWildcard(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func homeDir() string {
+	if u, err := user.Current(); err == nil && u.HomeDir != "" {
+		return u.HomeDir
+	}
+	home, _ := os.UserHomeDir()
+	return home
+}
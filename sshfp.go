@@ -0,0 +1,125 @@
+package simplessh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// An SSHFPRecord is an SSHFP DNS record as described in RFC 4255 and 6594.
+type SSHFPRecord struct {
+	// Algorithm of the key: 1 for RSA, 2 for DSA, 3 for ECDSA and 4 for
+	// Ed25519.
+	Algorithm uint8
+
+	// Type of the fingerprint: 1 for SHA-1 and 2 for SHA-256.
+	Type uint8
+
+	// Fingerprint is the digest of the key in wire format.
+	Fingerprint []byte
+}
+
+// An SSHFPResolver looks up the SSHFP records of host and reports whether the
+// answer was authenticated with DNSSEC. The standard library can't query
+// SSHFP records, so with github.com/miekg/dns it's typically implemented as:
+//
+//	func(ctx context.Context, host string) ([]simplessh.SSHFPRecord, bool, error) {
+//		m := new(dns.Msg).SetQuestion(dns.Fqdn(host), dns.TypeSSHFP)
+//		m.SetEdns0(4096, true)
+//		r, _, err := new(dns.Client).ExchangeContext(ctx, m, "127.0.0.1:53")
+//		if err != nil {
+//			return nil, false, err
+//		}
+//		var records []simplessh.SSHFPRecord
+//		for _, rr := range r.Answer {
+//			if fp, ok := rr.(*dns.SSHFP); ok {
+//				digest, _ := hex.DecodeString(fp.FingerPrint)
+//				records = append(records, simplessh.SSHFPRecord{fp.Algorithm, fp.Type, digest})
+//			}
+//		}
+//		return records, r.AuthenticatedData, nil
+//	}
+//
+// The AD flag is only trustworthy when the resolver is a validating one
+// reached over a trusted path, usually a local one.
+type SSHFPResolver func(ctx context.Context, host string) (records []SSHFPRecord, authenticated bool, err error)
+
+// sshfpTimeout bounds the DNS lookup done while verifying a host key.
+const sshfpTimeout = 10 * time.Second
+
+// WithSSHFP only accepts a server whose host key matches one of the SSHFP
+// records resolve returns for the host name. If requireDNSSEC is set answers
+// that weren't authenticated with DNSSEC are rejected, as ssh does with
+// VerifyHostKeyDNS. Keys without a matching record fail with a
+// *HostKeyMismatchError.
+func WithSSHFP(resolve SSHFPResolver, requireDNSSEC bool) Option {
+	return WithHostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host, _, err := net.SplitHostPort(hostname)
+		if err != nil {
+			host = hostname
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), sshfpTimeout)
+		defer cancel()
+
+		records, authenticated, err := resolve(ctx, host)
+		if err != nil {
+			return fmt.Errorf("SSHFP lookup for %s failed: %v", host, err)
+		}
+		if requireDNSSEC && !authenticated {
+			return fmt.Errorf("SSHFP records for %s aren't authenticated with DNSSEC", host)
+		}
+
+		if cert, ok := key.(*ssh.Certificate); ok {
+			key = cert.Key
+		}
+
+		mismatch := &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+		for _, record := range records {
+			if record.Algorithm != sshfpAlgorithm(key) {
+				continue
+			}
+
+			var digest []byte
+			switch record.Type {
+			case 1:
+				sum := sha1.Sum(key.Marshal())
+				digest = sum[:]
+			case 2:
+				sum := sha256.Sum256(key.Marshal())
+				digest = sum[:]
+				mismatch.Expected = append(mismatch.Expected, "SHA256:"+base64.RawStdEncoding.EncodeToString(record.Fingerprint))
+			default:
+				continue
+			}
+
+			if bytes.Equal(digest, record.Fingerprint) {
+				return nil
+			}
+		}
+
+		return mismatch
+	})
+}
+
+// sshfpAlgorithm returns the SSHFP algorithm number of key, 0 if it has none.
+func sshfpAlgorithm(key ssh.PublicKey) uint8 {
+	switch key.Type() {
+	case ssh.KeyAlgoRSA:
+		return 1
+	case ssh.KeyAlgoDSA:
+		return 2
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		return 3
+	case ssh.KeyAlgoED25519:
+		return 4
+	}
+	return 0
+}
@@ -0,0 +1,327 @@
+package simplessh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// A SyncOption configures how SyncDir compares and mirrors files.
+type SyncOption func(*syncOptions)
+
+type syncOptions struct {
+	delete   bool
+	checksum bool
+}
+
+// WithSyncDelete removes remote files and directories that aren't in the
+// local tree.
+func WithSyncDelete() SyncOption {
+	return func(o *syncOptions) {
+		o.delete = true
+	}
+}
+
+// WithSyncChecksum compares files by their SHA-256 checksum, computed on the
+// remote host with sha256sum or shasum, instead of by size and modification
+// time. It needs a POSIX shell on the remote host.
+func WithSyncChecksum() SyncOption {
+	return func(o *syncOptions) {
+		o.checksum = true
+	}
+}
+
+// A SyncSummary lists the changes SyncDir made, with paths relative to the
+// synced directories and using forward slashes.
+type SyncSummary struct {
+	Uploaded  []string
+	Deleted   []string
+	Unchanged int
+
+	// Bytes is the number of bytes uploaded.
+	Bytes int64
+}
+
+func (s *SyncSummary) String() string {
+	return fmt.Sprintf("%d uploaded (%d bytes), %d deleted, %d unchanged", len(s.Uploaded), s.Bytes, len(s.Deleted), s.Unchanged)
+}
+
+// SyncDir makes remoteDir a mirror of localDir over SFTP: new files and files
+// that changed are uploaded with the local permissions and modification
+// time, and directories are created as needed. Only regular files and
+// directories are synced. In dry-run mode the uploads and deletions are
+// recorded instead and reported in the summary as if they happened.
+func (c *Client) SyncDir(localDir, remoteDir string, opts ...SyncOption) (*SyncSummary, error) {
+	o := &syncOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer client.Close()
+	defer c.openChannel("sftp")()
+
+	remote, err := c.remoteTree(client, remoteDir, o.checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &SyncSummary{}
+	local := map[string]bool{}
+	err = filepath.WalkDir(localDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			if c.DryRun() {
+				return nil
+			}
+			return client.MkdirAll(c.remotePath(remoteDir))
+		}
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			return nil
+		}
+		local[rel] = true
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		target := path.Join(remoteDir, rel)
+		existing, exists := remote[rel]
+
+		if entry.IsDir() {
+			if exists && existing.dir {
+				return nil
+			}
+			if c.planned(PlannedAction{Kind: "mkdir", Remote: target}) {
+				return nil
+			}
+			if exists {
+				// A file is in the way of the directory.
+				if err := client.Remove(c.remotePath(target)); err != nil {
+					return err
+				}
+			}
+			if err := client.MkdirAll(c.remotePath(target)); err != nil {
+				return err
+			}
+			if c.platform.Windows() {
+				return nil
+			}
+			return client.Chmod(c.remotePath(target), info.Mode().Perm())
+		}
+
+		if exists && !existing.dir {
+			same, err := sameFile(p, info, existing, o.checksum)
+			if err != nil {
+				return err
+			}
+			if same {
+				summary.Unchanged++
+				return nil
+			}
+		}
+
+		summary.Uploaded = append(summary.Uploaded, rel)
+		if c.planned(PlannedAction{Kind: "upload", Local: p, Remote: target}) {
+			return nil
+		}
+		if exists && existing.dir {
+			if err := client.RemoveAll(c.remotePath(target)); err != nil {
+				return err
+			}
+		}
+		n, err := c.syncFile(client, p, target, info)
+		summary.Bytes += n
+		return err
+	})
+	if err != nil {
+		return summary, fmt.Errorf("Couldn't sync %s to %s: %w", localDir, remoteDir, err)
+	}
+
+	if o.delete {
+		if err := c.deleteExtraneous(client, remoteDir, remote, local, summary); err != nil {
+			return summary, fmt.Errorf("Couldn't sync %s to %s: %w", localDir, remoteDir, err)
+		}
+	}
+
+	c.log().Info("Sync finished", "local", localDir, "remote", remoteDir, "uploaded", len(summary.Uploaded), "deleted", len(summary.Deleted), "bytes", summary.Bytes)
+	return summary, nil
+}
+
+// A remoteEntry is a file or directory found by remoteTree.
+type remoteEntry struct {
+	dir     bool
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+// remoteTree lists remoteDir by path relative to it, with checksums if
+// they're needed. A missing remoteDir is empty.
+func (c *Client) remoteTree(client *sftp.Client, remoteDir string, checksum bool) (map[string]remoteEntry, error) {
+	tree := map[string]remoteEntry{}
+
+	// Walk cleans the paths it returns, so the root has to be clean to be
+	// trimmed from them.
+	root := path.Clean(c.remotePath(remoteDir))
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root && errors.Is(err, os.ErrNotExist) {
+				return tree, nil
+			}
+			return nil, err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		if rel == "" {
+			continue
+		}
+		info := walker.Stat()
+		tree[rel] = remoteEntry{dir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+	}
+
+	if !checksum || len(tree) == 0 {
+		return tree, nil
+	}
+	if c.platform.Windows() {
+		return nil, errors.New("Checksums aren't supported on Windows hosts")
+	}
+
+	output, err := c.fileExec(`cd -- `+Quote(remoteDir)+` && find . -type f -exec sh -c 'sha256sum "$@" 2>/dev/null || shasum -a 256 "$@"' sh {} +`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't compute checksums in %s: %w", remoteDir, err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		rel := strings.TrimPrefix(name, "./")
+		if entry, ok := tree[rel]; ok {
+			entry.sha256 = sum
+			tree[rel] = entry
+		}
+	}
+	return tree, nil
+}
+
+// sameFile reports whether the local file at p matches the remote one.
+func sameFile(p string, info fs.FileInfo, remote remoteEntry, checksum bool) (bool, error) {
+	if info.Size() != remote.size {
+		return false, nil
+	}
+	if !checksum {
+		// SFTP only keeps whole seconds.
+		return info.ModTime().Unix() == remote.modTime.Unix(), nil
+	}
+
+	sum, err := fileSHA256(p)
+	if err != nil {
+		return false, err
+	}
+	return sum == remote.sha256, nil
+}
+
+// fileSHA256 returns the hex-encoded checksum of the local file at p.
+func fileSHA256(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// syncFile uploads the local file to remote with its permissions and
+// modification time.
+func (c *Client) syncFile(client *sftp.Client, local, remote string, info fs.FileInfo) (n int64, err error) {
+	start := time.Now()
+	defer func() {
+		c.logTransfer("Upload", remote, local, n, start, err)
+		c.transferred("upload", remote, local, n, start, 0, err)
+	}()
+
+	localFile, err := os.Open(local)
+	if err != nil {
+		return 0, err
+	}
+	defer localFile.Close()
+
+	remoteFile, err := client.Create(c.remotePath(remote))
+	if err != nil {
+		return 0, err
+	}
+	n, err = io.Copy(remoteFile, localFile)
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if !c.platform.Windows() {
+		if err := client.Chmod(c.remotePath(remote), info.Mode().Perm()); err != nil {
+			return n, err
+		}
+	}
+	return n, client.Chtimes(c.remotePath(remote), time.Now(), info.ModTime())
+}
+
+// deleteExtraneous removes what's in the remote tree but not the local one.
+func (c *Client) deleteExtraneous(client *sftp.Client, remoteDir string, remote map[string]remoteEntry, local map[string]bool, summary *SyncSummary) error {
+	var extraneous []string
+	for rel := range remote {
+		if !local[rel] {
+			extraneous = append(extraneous, rel)
+		}
+	}
+	sort.Strings(extraneous)
+
+	removed := map[string]bool{}
+	for _, rel := range extraneous {
+		if removed[path.Dir(rel)] {
+			// Whatever is in a removed directory went with it.
+			removed[rel] = true
+			continue
+		}
+
+		target := path.Join(remoteDir, rel)
+		summary.Deleted = append(summary.Deleted, rel)
+		removed[rel] = true
+		if c.planned(PlannedAction{Kind: "delete", Remote: target}) {
+			continue
+		}
+		if err := client.RemoveAll(c.remotePath(target)); err != nil {
+			return err
+		}
+		c.log().Info("Removed extraneous file", "remote", target)
+	}
+	return nil
+}
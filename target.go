@@ -0,0 +1,108 @@
+package simplessh
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// A Target is a parsed connection target.
+type Target struct {
+	User string
+	Host string
+	Port string
+}
+
+// ParseTarget parses a target given as an ssh:// URL such as
+// "ssh://deploy@10.0.0.5:2222" or in the user@host:port form ssh accepts on
+// its command line. The user and port are optional. IPv6 addresses with a
+// port need brackets, as in "[2001:db8::1]:2222"; without a port they may be
+// given with or without them, including with a zone such as fe80::1%eth0.
+func ParseTarget(s string) (Target, error) {
+	if strings.HasPrefix(s, "ssh://") {
+		return parseTargetURL(s)
+	}
+
+	var t Target
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		t.User, s = s[:i], s[i+1:]
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	switch {
+	case err == nil:
+		t.Host, t.Port = host, port
+	case strings.HasPrefix(s, "["):
+		// A bracketed IPv6 address without a port.
+		if !strings.HasSuffix(s, "]") {
+			return Target{}, fmt.Errorf("Target %q has an invalid IPv6 address", s)
+		}
+		t.Host = s[1 : len(s)-1]
+	default:
+		// IPv6 addresses without brackets, such as fe80::1%eth0, can't have
+		// a port.
+		t.Host = s
+	}
+
+	if strings.HasPrefix(s, "[") {
+		if _, err := netip.ParseAddr(t.Host); err != nil {
+			return Target{}, fmt.Errorf("Target %q has an invalid IPv6 address", s)
+		}
+	}
+
+	if t.Host == "" {
+		return Target{}, fmt.Errorf("Target %q has no host", s)
+	}
+
+	return t, nil
+}
+
+func parseTargetURL(s string) (Target, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Target{}, err
+	}
+	if u.Path != "" && u.Path != "/" {
+		return Target{}, fmt.Errorf("Target %q must not have a path", s)
+	}
+
+	t := Target{Host: u.Hostname(), Port: u.Port()}
+	if u.User != nil {
+		t.User = u.User.Username()
+	}
+
+	if t.Host == "" {
+		return Target{}, fmt.Errorf("Target %q has no host", s)
+	}
+
+	return t, nil
+}
+
+// Addr returns the host:port to dial, using DefaultPort if the target didn't
+// specify one.
+func (t Target) Addr() string {
+	return t.addr(DefaultPort)
+}
+
+func (t Target) addr(defaultPort string) string {
+	port := t.Port
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(t.Host, port)
+}
+
+// String returns the target in user@host:port form, omitting the parts that
+// weren't specified.
+func (t Target) String() string {
+	s := t.Host
+	if t.Port != "" {
+		s = net.JoinHostPort(t.Host, t.Port)
+	}
+	if t.User != "" {
+		s = t.User + "@" + s
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package simplessh
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Target
+		addr string
+	}{
+		{"host", Target{Host: "host"}, "host:22"},
+		{"deploy@host", Target{User: "deploy", Host: "host"}, "host:22"},
+		{"host:2222", Target{Host: "host", Port: "2222"}, "host:2222"},
+		{"deploy@10.0.0.5:2222", Target{User: "deploy", Host: "10.0.0.5", Port: "2222"}, "10.0.0.5:2222"},
+		{"user@corp@host", Target{User: "user@corp", Host: "host"}, "host:22"},
+		{"2001:db8::1", Target{Host: "2001:db8::1"}, "[2001:db8::1]:22"},
+		{"[2001:db8::1]", Target{Host: "2001:db8::1"}, "[2001:db8::1]:22"},
+		{"[2001:db8::1]:2222", Target{Host: "2001:db8::1", Port: "2222"}, "[2001:db8::1]:2222"},
+		{"u@fe80::1%eth0", Target{User: "u", Host: "fe80::1%eth0"}, "[fe80::1%eth0]:22"},
+		{"[fe80::1%eth0]:2222", Target{Host: "fe80::1%eth0", Port: "2222"}, "[fe80::1%eth0]:2222"},
+		{"ssh://host", Target{Host: "host"}, "host:22"},
+		{"ssh://deploy@10.0.0.5:2222", Target{User: "deploy", Host: "10.0.0.5", Port: "2222"}, "10.0.0.5:2222"},
+		{"ssh://deploy@host/", Target{User: "deploy", Host: "host"}, "host:22"},
+		{"ssh://[2001:db8::1]:2222", Target{Host: "2001:db8::1", Port: "2222"}, "[2001:db8::1]:2222"},
+		{"ssh://[fe80::1%25eth0]", Target{Host: "fe80::1%eth0"}, "[fe80::1%eth0]:22"},
+	}
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.s)
+		if err != nil {
+			t.Errorf("ParseTarget(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+		if addr := got.Addr(); addr != tt.addr {
+			t.Errorf("ParseTarget(%q).Addr() = %s, want %s", tt.s, addr, tt.addr)
+		}
+	}
+}
+
+func TestParseTargetErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"deploy@",
+		":22",
+		"[2001:db8::1",
+		"[host]",
+		"[host]:22",
+		"ssh://",
+		"ssh://deploy@:22",
+		"ssh://host/path",
+	} {
+		if got, err := ParseTarget(s); err == nil {
+			t.Errorf("ParseTarget(%q) = %+v, want an error", s, got)
+		}
+	}
+}
+
+func TestTargetString(t *testing.T) {
+	tests := []struct {
+		target Target
+		want   string
+	}{
+		{Target{Host: "host"}, "host"},
+		{Target{User: "deploy", Host: "host", Port: "2222"}, "deploy@host:2222"},
+		{Target{Host: "2001:db8::1", Port: "22"}, "[2001:db8::1]:22"},
+	}
+	for _, tt := range tests {
+		if got := tt.target.String(); got != tt.want {
+			t.Errorf("%+v.String() = %s, want %s", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package simplessh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/norman-abramovitz/simplessh"
+
+// WithTracerProvider records OpenTelemetry spans for connecting, commands,
+// uploads, downloads and forwarded connections with tracers from provider.
+// Spans carry the host, user, byte counts and, for commands, a SHA-256 hash of
+// the command line rather than the command itself since commands may contain
+// secrets. Use WithConnectContext and WithCommandContext to make them children
+// of the caller's spans.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// WithConnectContext sets the context used while connecting. Connecting is
+// abandoned when ctx is done and the span recorded for the connection, if
+// any, is a child of the span in ctx.
+func WithConnectContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithCommandContext sets the context of the command. The command is stopped
+// like with WithCommandTimeout when ctx is done and the span recorded for it,
+// if any, is a child of the span in ctx.
+func WithCommandContext(ctx context.Context) ExecOption {
+	return func(o *execOptions) {
+		o.ctx = ctx
+	}
+}
+
+func (o *options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+func (o *execOptions) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// startSpan starts a client span with tracer, or a span that records nothing
+// if tracer is nil.
+func startSpan(ctx context.Context, tracer trace.Tracer, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if tracer == nil {
+		return ctx, noop.Span{}
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// hostAttrs returns the attributes identifying the server of a connection.
+func hostAttrs(host, user string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("ssh.user", user)}
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return append(attrs, attribute.String("server.address", host))
+	}
+	attrs = append(attrs, attribute.String("server.address", hostname))
+	if n, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, attribute.Int("server.port", n))
+	}
+	return attrs
+}
+
+// startSpan starts a span for an operation on the connection.
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return startSpan(ctx, c.tracer, name, append(hostAttrs(c.host, c.user), attrs...)...)
+}
+
+// commandHash identifies a command in spans without revealing it.
+func commandHash(cmd string) string {
+	sum := sha256.Sum256([]byte(cmd))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,92 @@
+package simplessh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WithDialTimeout limits how long opening the TCP connection may take. It
+// defaults to the timeout passed to the Connect function.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithHandshakeTimeout limits how long the version exchange and key exchange
+// may take once the TCP connection is open, so a server that accepts
+// connections but never speaks SSH can't stall the client. It defaults to the
+// timeout passed to the Connect function.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.handshakeTimeout = timeout
+	}
+}
+
+// WithAuthTimeout limits how long authentication may take after the key
+// exchange, including the time spent in passphrase, password and
+// keyboard-interactive prompts. It defaults to the timeout passed to the
+// Connect function.
+func WithAuthTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.authTimeout = timeout
+	}
+}
+
+// timeouts returns the dial, handshake and authentication timeouts, falling
+// back to timeout for those that weren't set.
+func (o *options) timeouts(timeout time.Duration) (dial, handshake, auth time.Duration) {
+	dial, handshake, auth = o.dialTimeout, o.handshakeTimeout, o.authTimeout
+	for _, t := range []*time.Duration{&dial, &handshake, &auth} {
+		if *t == 0 {
+			*t = timeout
+		}
+	}
+	return dial, handshake, auth
+}
+
+// clientHandshake is ssh.NewClientConn with deadlines: the key exchange has to
+// be done within handshakeTimeout and authentication within authTimeout after
+// that. The deadlines are cleared once the connection is established.
+func clientHandshake(conn net.Conn, addr string, config *ssh.ClientConfig, handshakeTimeout, authTimeout time.Duration) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	var authenticating, connected atomic.Bool
+
+	hostKeyCallback := config.HostKeyCallback
+	withDeadlines := *config
+	withDeadlines.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		// The host key is checked again on every rekey, only the first
+		// check marks the end of the handshake.
+		if !connected.Load() && !authenticating.Swap(true) {
+			conn.SetDeadline(time.Now().Add(authTimeout))
+		}
+		return hostKeyCallback(hostname, remote, key)
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &withDeadlines)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			if authenticating.Load() {
+				return nil, nil, nil, fmt.Errorf("%w: authentication to %s took longer than %v", ErrConnectTimeout, addr, authTimeout)
+			}
+			return nil, nil, nil, fmt.Errorf("%w: SSH handshake with %s took longer than %v", ErrConnectTimeout, addr, handshakeTimeout)
+		}
+		// golang.org/x/crypto/ssh doesn't have an error type for this.
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, nil, nil, fmt.Errorf("%w: %w", ErrAuthFailed, err)
+		}
+		return nil, nil, nil, err
+	}
+
+	connected.Store(true)
+	conn.SetDeadline(time.Time{})
+
+	return sshConn, chans, reqs, nil
+}
@@ -0,0 +1,66 @@
+package simplessh
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// WithTLS wraps the connection in TLS before the SSH handshake, for SSH
+// servers behind TLS-terminating load balancers and multiplexers such as
+// sslh. config.ServerName, sent with SNI and used to verify the certificate,
+// defaults to the host connected to, and config.Certificates holds the
+// client certificates to present, if any. It applies on top of the dialer,
+// so it can be combined with WithProxyCommand and WithDialer.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tls = config
+	}
+}
+
+// dialConn opens the connection to host: dialed, through the SRV records if
+// enabled, then with the PROXY protocol header sent and wrapped in TLS if
+// enabled.
+func (o *options) dialConn(ctx context.Context, host string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if o.srvLookup {
+		conn, err = o.dialSRV(ctx, host)
+	} else {
+		conn, err = o.dial(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.proxyProtocol != 0 {
+		header, err := proxyProtocolHeader(o.proxyProtocol, conn)
+		if err == nil {
+			_, err = conn.Write(header)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if o.tls == nil {
+		return conn, nil
+	}
+
+	config := o.tls.Clone()
+	if config.ServerName == "" {
+		hostname, _, err := net.SplitHostPort(host)
+		if err != nil {
+			hostname = host
+		}
+		config.ServerName = hostname
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,151 @@
+package simplessh
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WithTrace logs the details of the SSH protocol exchange at the debug level,
+// like ssh -vvv: the server's version and host key, the negotiated
+// algorithms, every authentication attempt and every channel opened or
+// closed along with the requests sent on it. Traces go to the logger given
+// with WithLogger, or to slog.Default if there isn't one. It's meant for
+// diagnosing a single connection that won't come up or misbehaves.
+func WithTrace() Option {
+	return func(o *options) {
+		o.trace = true
+	}
+}
+
+// traceLogger returns the logger traces go to.
+func (o *options) traceLogger(host string) *slog.Logger {
+	logger := o.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("host", host, "trace", true)
+}
+
+// traceConfig returns a copy of config that logs the host key and the
+// authentication attempts to logger.
+func traceConfig(config *ssh.ClientConfig, logger *slog.Logger) *ssh.ClientConfig {
+	traced := *config
+
+	hostKeyCallback := config.HostKeyCallback
+	traced.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeyCallback(hostname, remote, key)
+		logger.Debug("Server host key", "remote", remote.String(), "key_type", key.Type(),
+			"fingerprint", ssh.FingerprintSHA256(key), "error", err)
+		return err
+	}
+
+	var loggedAlgorithms bool
+	authCallback := config.AuthCallback
+	traced.AuthCallback = func(ctx *ssh.ClientAuthContext) (ssh.AuthMethod, error) {
+		if !loggedAlgorithms {
+			loggedAlgorithms = true
+			logger.Debug("Negotiated algorithms", "server_version", string(ctx.Metadata.ServerVersion()),
+				algorithmAttrs(ctx.Algorithms))
+		}
+		logger.Debug("Authentication attempt", "user", ctx.Metadata.User(),
+			"allowed_methods", ctx.AllowedMethods, "tried_methods", ctx.TriedMethods,
+			"partial_success", ctx.PartialSuccessMethods)
+
+		if authCallback != nil {
+			return authCallback(ctx)
+		}
+		return nil, nil
+	}
+
+	return &traced
+}
+
+func algorithmAttrs(algorithms ssh.NegotiatedAlgorithms) slog.Attr {
+	return slog.Group("algorithms",
+		"kex", algorithms.KeyExchange,
+		"host_key", algorithms.HostKey,
+		"cipher_out", algorithms.Write.Cipher,
+		"cipher_in", algorithms.Read.Cipher,
+		"mac_out", algorithms.Write.MAC,
+		"mac_in", algorithms.Read.MAC,
+	)
+}
+
+// traceConn logs the channels opened on an established connection.
+type traceConn struct {
+	ssh.Conn
+	logger *slog.Logger
+	nextID atomic.Int64
+}
+
+// newTraceConn wraps conn and the channels the server opens so they're
+// logged to logger.
+func newTraceConn(conn ssh.Conn, chans <-chan ssh.NewChannel, logger *slog.Logger) (ssh.Conn, <-chan ssh.NewChannel) {
+	if algorithmsConn, ok := conn.(ssh.AlgorithmsConnMetadata); ok {
+		logger.Debug("Authenticated", algorithmAttrs(algorithmsConn.Algorithms()))
+	}
+
+	traced := make(chan ssh.NewChannel)
+	go func() {
+		defer close(traced)
+		for newChannel := range chans {
+			logger.Debug("Server opened channel", "type", newChannel.ChannelType())
+			traced <- newChannel
+		}
+		logger.Debug("Connection closed")
+	}()
+
+	return &traceConn{Conn: conn, logger: logger}, traced
+}
+
+func (c *traceConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	channel, reqs, err := c.Conn.OpenChannel(name, data)
+	if err != nil {
+		c.logger.Debug("Opening channel failed", "type", name, "error", err)
+		return nil, nil, err
+	}
+
+	logger := c.logger.With("channel", c.nextID.Add(1), "type", name)
+	logger.Debug("Channel opened")
+
+	tracedReqs := make(chan *ssh.Request)
+	go func() {
+		defer close(tracedReqs)
+		for req := range reqs {
+			logger.Debug("Channel request received", "request", req.Type, "want_reply", req.WantReply)
+			tracedReqs <- req
+		}
+		logger.Debug("Channel closed by server")
+	}()
+
+	return &traceChannel{Channel: channel, logger: logger}, tracedReqs, nil
+}
+
+func (c *traceConn) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	ok, response, err := c.Conn.SendRequest(name, wantReply, payload)
+	c.logger.Debug("Global request sent", "request", name, "want_reply", wantReply, "ok", ok, "error", err)
+	return ok, response, err
+}
+
+type traceChannel struct {
+	ssh.Channel
+	logger *slog.Logger
+	once   sync.Once
+}
+
+func (ch *traceChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	ok, err := ch.Channel.SendRequest(name, wantReply, payload)
+	ch.logger.Debug("Channel request sent", "request", name, "want_reply", wantReply, "ok", ok, "error", err)
+	return ok, err
+}
+
+func (ch *traceChannel) Close() error {
+	ch.once.Do(func() {
+		ch.logger.Debug("Channel closed")
+	})
+	return ch.Channel.Close()
+}
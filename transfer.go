@@ -0,0 +1,189 @@
+package simplessh
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// A TransferOption configures how Upload and Download copy a file.
+type TransferOption func(*transferOptions)
+
+type transferOptions struct {
+	sparse bool
+	xattrs bool
+	atomic bool
+	fsync  bool
+	retry  RetryPolicy
+}
+
+func newTransferOptions(opts []TransferOption) *transferOptions {
+	o := &transferOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSparse skips writing the runs of zeros in the file, so the copy is
+// sparse on file systems that support it, such as for VM disk images and core
+// dumps. The zeros are still read, and sent over the connection when
+// downloading.
+func WithSparse() TransferOption {
+	return func(o *transferOptions) {
+		o.sparse = true
+	}
+}
+
+// WithAtomicUpload uploads to a temporary file next to the remote file and
+// renames it into place once complete, see Client.Rename, so readers never
+// see a partial file. Download ignores it.
+func WithAtomicUpload() TransferOption {
+	return func(o *transferOptions) {
+		o.atomic = true
+	}
+}
+
+// WithFsync flushes the uploaded file to stable storage on the remote host
+// before Upload returns, see Client.Fsync. Download ignores it.
+func WithFsync() TransferOption {
+	return func(o *transferOptions) {
+		o.fsync = true
+	}
+}
+
+// A TransferSummary describes a finished upload or download, including one
+// that failed part way.
+type TransferSummary struct {
+	Host string
+
+	// Direction is "upload" or "download".
+	Direction string
+	Local     string
+	Remote    string
+
+	// Bytes is the number of bytes of file data sent or received by the
+	// last attempt.
+	Bytes int64
+
+	// Duration spans all of the attempts when retrying.
+	Duration time.Duration
+
+	// Rate is the average rate in bytes per second, 0 if the transfer took
+	// no measurable time.
+	Rate float64
+
+	// Retries is the number of times the transfer was retried with
+	// WithTransferRetry.
+	Retries int
+
+	// Err is nil if the transfer succeeded.
+	Err error
+}
+
+// WithTransferSummary calls callback after every upload and download, including
+// those of SyncDir and UploadDelta, so transfer statistics can be aggregated.
+// It may be called concurrently and shouldn't block.
+func WithTransferSummary(callback func(TransferSummary)) Option {
+	return func(o *options) {
+		o.transferSummary = callback
+	}
+}
+
+// transferred reports a finished transfer to the MetricsRecorder and the
+// WithTransferSummary callback.
+func (c *Client) transferred(direction, remote, local string, bytes int64, start time.Time, retries int, err error) {
+	c.recorder().Transferred(c.host, direction, bytes)
+	if c.transferSummary == nil {
+		return
+	}
+
+	duration := time.Since(start)
+	var rate float64
+	if duration > 0 {
+		rate = float64(bytes) / duration.Seconds()
+	}
+	c.transferSummary(TransferSummary{
+		Host:      c.host,
+		Direction: direction,
+		Local:     local,
+		Remote:    remote,
+		Bytes:     bytes,
+		Duration:  duration,
+		Rate:      rate,
+		Retries:   retries,
+		Err:       err,
+	})
+}
+
+// A destination is the file a transfer writes to, either local or remote.
+type destination interface {
+	io.Writer
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// copy copies src to the empty file dst and returns the number of bytes
+// copied.
+func (o *transferOptions) copy(dst destination, src io.Reader) (int64, error) {
+	if !o.sparse {
+		return io.Copy(dst, src)
+	}
+
+	w := &sparseWriter{w: dst}
+	// Hiding the source's WriterTo makes the copy use a buffer big enough
+	// for sparseWriter to write whole runs of data at once.
+	n, err := io.CopyBuffer(w, struct{ io.Reader }{src}, make([]byte, 1<<20))
+	if err != nil {
+		return n, err
+	}
+	// A trailing hole has nothing written to it.
+	return n, dst.Truncate(n)
+}
+
+// sparseBlock is the granularity at which zeros are skipped, the block size
+// of most file systems.
+const sparseBlock = 4096
+
+// sparseWriter writes to w at increasing offsets, skipping blocks of zeros.
+type sparseWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+var zeroBlock = make([]byte, sparseBlock)
+
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Find the next run of data and write it in one go.
+		n := 0
+		for n < len(p) {
+			block := p[n:min(n+sparseBlock, len(p))]
+			if bytes.Equal(block, zeroBlock[:len(block)]) {
+				break
+			}
+			n += len(block)
+		}
+		if n > 0 {
+			if _, err := s.w.WriteAt(p[:n], s.off); err != nil {
+				return written, err
+			}
+		}
+		s.off += int64(n)
+		written += n
+		p = p[n:]
+
+		// Skip the run of zeros after it.
+		for len(p) > 0 {
+			block := p[:min(sparseBlock, len(p))]
+			if !bytes.Equal(block, zeroBlock[:len(block)]) {
+				break
+			}
+			s.off += int64(len(block))
+			written += len(block)
+			p = p[len(block):]
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,133 @@
+package simplessh
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// A DialFunc opens the connection the SSH protocol runs over. addr is the
+// host:port being connected to and ctx expires when the connect timeout does.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithDialer replaces the TCP dial with dial, for transports simplessh
+// doesn't know about. The default dial races the IPv6 and IPv4 addresses of
+// dual-stack hosts so an unreachable address family doesn't hold up the
+// connection.
+func WithDialer(dial DialFunc) Option {
+	return func(o *options) {
+		o.dial = dial
+	}
+}
+
+// WithNetDialer dials the TCP connection with d, keeping the racing of IPv6
+// and IPv4 addresses, so its LocalAddr can bind the source address on
+// multi-homed hosts, KeepAliveConfig can enable TCP keepalives and Control can
+// set socket options such as the DSCP bits with IP_TOS. The connect timeout
+// still applies on top of d.Timeout.
+func WithNetDialer(d *net.Dialer) Option {
+	return WithDialer(dialHappyEyeballs(d))
+}
+
+// WithProxyCommand runs command and speaks SSH over its stdin and stdout
+// instead of dialing the host, like ssh's ProxyCommand. The command is run by
+// the shell after replacing %h with the host, %p with the port and %% with %.
+// Its stderr is passed through to ours.
+func WithProxyCommand(command string) Option {
+	return WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded := strings.NewReplacer("%%", "%", "%h", host, "%p", port).Replace(command)
+
+		return dialCommand(shellCommand(expanded))
+	})
+}
+
+// WithSSMSession tunnels the connection through an AWS Systems Manager
+// session using the AWS-StartSSHSession document, so instances without a
+// public IP or an open port 22 can be reached. The host passed to the Connect
+// function must be the instance ID. It requires the AWS CLI and the Session
+// Manager plugin; awsArgs are passed on to the CLI, e.g. "--region",
+// "eu-west-1" or "--profile", "ops".
+func WithSSMSession(awsArgs ...string) Option {
+	return WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		instanceID, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		args := append([]string{
+			"ssm", "start-session",
+			"--target", instanceID,
+			"--document-name", "AWS-StartSSHSession",
+			"--parameters", "portNumber=" + port,
+		}, awsArgs...)
+
+		return dialCommand(exec.Command("aws", args...))
+	})
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+// dialCommand starts cmd and returns a connection over its stdin and stdout.
+func dialCommand(cmd *exec.Cmd) (net.Conn, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &cmdConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+// cmdConn is a net.Conn over the standard streams of a command. Deadlines
+// aren't supported and are silently ignored.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func (c *cmdConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *cmdConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+func (c *cmdConn) Close() error {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr                { return cmdAddr{c.cmd} }
+func (c *cmdConn) RemoteAddr() net.Addr               { return cmdAddr{c.cmd} }
+func (c *cmdConn) SetDeadline(t time.Time) error      { return nil }
+func (c *cmdConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type cmdAddr struct {
+	cmd *exec.Cmd
+}
+
+func (a cmdAddr) Network() string { return "command" }
+func (a cmdAddr) String() string  { return a.cmd.String() }
@@ -0,0 +1,197 @@
+package simplessh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A VaultSigner authenticates with short-lived user certificates issued by the
+// SSH secrets engine of HashiCorp Vault. A key pair is generated in memory the
+// first time it's needed and its public key is signed right before connecting.
+// The certificate is reused across connections until it's about to expire and
+// then signed again, so a single VaultSigner can be shared by many clients.
+type VaultSigner struct {
+	// Address of the Vault server, defaults to $VAULT_ADDR.
+	Address string
+
+	// Token to authenticate to Vault with, defaults to $VAULT_TOKEN.
+	Token string
+
+	// Namespace for Vault Enterprise, defaults to $VAULT_NAMESPACE.
+	Namespace string
+
+	// Mount is the path the SSH secrets engine is mounted at, "ssh" if empty.
+	Mount string
+
+	// Role that signs the certificate.
+	Role string
+
+	// Principals to request, the role's defaults are used if empty.
+	Principals []string
+
+	// TTL to request, the role's default is used if zero.
+	TTL time.Duration
+
+	// RenewBefore is how long before the certificate expires it's signed
+	// again, 30 seconds if zero.
+	RenewBefore time.Duration
+
+	// HTTPClient makes the requests to Vault, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	key    ssh.Signer
+	cert   *ssh.Certificate
+	signer ssh.Signer
+}
+
+// Connect with a certificate signed by Vault. If username is empty simplessh will attempt to get the current user.
+func ConnectWithVault(host, username string, v *VaultSigner, opts ...Option) (*Client, error) {
+	return ConnectWithVaultTimeout(host, username, v, DefaultTimeout, opts...)
+}
+
+// Same as ConnectWithVault but allows a custom timeout. If username is empty simplessh will attempt to get the current user.
+func ConnectWithVaultTimeout(host, username string, v *VaultSigner, timeout time.Duration, opts ...Option) (*Client, error) {
+	authMethod := publicKeysCallback(opts, v.signers)
+
+	return connect(username, host, []ssh.AuthMethod{authMethod}, timeout, opts)
+}
+
+// AuthMethod returns an auth method that requests a certificate from Vault
+// when the server is ready to accept one, for use in a custom ClientConfig.
+func (v *VaultSigner) AuthMethod() ssh.AuthMethod {
+	return ssh.PublicKeysCallback(v.signers)
+}
+
+func (v *VaultSigner) signers() ([]ssh.Signer, error) {
+	signer, err := v.Signer(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return []ssh.Signer{signer}, nil
+}
+
+// Signer returns a signer for a certificate that's valid for at least
+// RenewBefore, asking Vault to sign a new one if needed.
+func (v *VaultSigner) Signer(ctx context.Context) (ssh.Signer, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.signer != nil && v.valid() {
+		return v.signer, nil
+	}
+
+	if v.key == nil {
+		key, err := newEphemeralSigner()
+		if err != nil {
+			return nil, err
+		}
+		v.key = key
+	}
+
+	cert, err := v.sign(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewCertSigner(cert, v.key)
+	if err != nil {
+		return nil, err
+	}
+
+	v.cert, v.signer = cert, signer
+	return signer, nil
+}
+
+// valid reports whether the current certificate outlives RenewBefore.
+func (v *VaultSigner) valid() bool {
+	if v.cert.ValidBefore == ssh.CertTimeInfinity {
+		return true
+	}
+
+	renewBefore := v.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = 30 * time.Second
+	}
+
+	return time.Now().Add(renewBefore).Before(time.Unix(int64(v.cert.ValidBefore), 0))
+}
+
+func (v *VaultSigner) sign(ctx context.Context) (*ssh.Certificate, error) {
+	address := firstNonEmpty(v.Address, os.Getenv("VAULT_ADDR"))
+	if address == "" {
+		return nil, fmt.Errorf("Vault address isn't set")
+	}
+	mount := firstNonEmpty(v.Mount, "ssh")
+
+	request := map[string]string{
+		"public_key": string(ssh.MarshalAuthorizedKey(v.key.PublicKey())),
+		"cert_type":  "user",
+	}
+	if len(v.Principals) > 0 {
+		request["valid_principals"] = strings.Join(v.Principals, ",")
+	}
+	if v.TTL > 0 {
+		request["ttl"] = v.TTL.String()
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/sign/%s", strings.TrimSuffix(address, "/"), strings.Trim(mount, "/"), v.Role)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", firstNonEmpty(v.Token, os.Getenv("VAULT_TOKEN")))
+	if namespace := firstNonEmpty(v.Namespace, os.Getenv("VAULT_NAMESPACE")); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	httpClient := v.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Errors []string `json:"errors"`
+		Data   struct {
+			SignedKey string `json:"signed_key"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("Vault returned %s: %v", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Vault returned %s: %s", resp.Status, strings.Join(response.Errors, "; "))
+	}
+
+	return ParseCertificate([]byte(response.Data.SignedKey))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
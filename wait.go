@@ -0,0 +1,74 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WaitForSSH keeps trying to connect to host with chain until it succeeds or
+// maxWait has passed, for provisioning workflows that boot a machine and must
+// wait for sshd to come up. Failed authentication is retried too, since keys
+// are often installed after sshd starts, but a host key mismatch, a host
+// missing from known_hosts and an open circuit breaker aren't. The wait
+// between attempts grows from one second to ten.
+func WaitForSSH(host, username string, chain AuthChain, maxWait time.Duration, opts ...Option) (*Client, error) {
+	deadline := time.Now().Add(maxWait)
+	backoff := time.Second
+
+	for {
+		timeout := min(DefaultTimeout, time.Until(deadline))
+		if timeout <= 0 {
+			timeout = time.Second
+		}
+
+		client, err := ConnectWithAuthChainTimeout(host, username, chain, timeout, opts...)
+		if err == nil {
+			return client, nil
+		}
+		if errors.Is(err, ErrHostKeyMismatch) || errors.Is(err, ErrUnknownHost) || errors.Is(err, ErrCircuitOpen) {
+			return nil, err
+		}
+
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return nil, fmt.Errorf("SSH on %s wasn't ready after %v: %w", host, maxWait, err)
+		}
+		time.Sleep(wait)
+		backoff = min(2*backoff, 10*time.Second)
+	}
+}
+
+// WaitForPort polls addr from the remote host through the SSH connection until
+// it accepts TCP connections or timeout has passed, for steps that wait for a
+// service that was just started to listen. It returns early if the SSH
+// connection itself fails.
+func (c *Client) WaitForPort(addr string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		attemptCtx, cancelAttempt := context.WithTimeout(ctx, 5*time.Second)
+		conn, err := c.DialContext(attemptCtx, "tcp", addr)
+		cancelAttempt()
+		if err == nil {
+			return conn.Close()
+		}
+
+		// The server reports refused connections by rejecting the channel,
+		// anything else means the SSH connection is unusable.
+		var rejected *ssh.OpenChannelError
+		if !errors.As(err, &rejected) && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s wasn't listening after %v: %w", addr, timeout, err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
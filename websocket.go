@@ -0,0 +1,386 @@
+package simplessh
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithWebSocket runs the SSH protocol over a WebSocket connection to wsURL, a
+// ws:// or wss:// URL, instead of dialing the host, for hosts only reachable
+// through HTTP ingresses and gateways. header is sent with the opening
+// handshake, for example for authenticating to the gateway. tlsConfig is used
+// for wss:// URLs, for gateways with a private CA or requiring client
+// certificates; its ServerName defaults to the gateway's host name and nil
+// means the defaults. The gateway is reached through the proxy named by the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables, if any. It has
+// to pass the binary messages on to the SSH server, as websockify does. The
+// host given to the Connect functions is still used to check the host key.
+func WithWebSocket(wsURL string, header http.Header, tlsConfig *tls.Config) Option {
+	return WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialWebSocket(ctx, wsURL, header, tlsConfig)
+	})
+}
+
+// websocketGUID is appended to the key to compute Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// dialWebSocket connects to wsURL and performs the opening handshake.
+func dialWebSocket(ctx context.Context, wsURL string, header http.Header, tlsConfig *tls.Config) (_ net.Conn, err error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	var secure bool
+	switch u.Scheme {
+	case "ws":
+	case "wss":
+		secure = true
+	default:
+		return nil, fmt.Errorf("Unsupported WebSocket URL scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if secure {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	// http.Request.Write takes the request line from the URL, which needs an
+	// HTTP scheme, as does finding the proxy.
+	httpURL := *u
+	httpURL.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	proxyURL, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = dialHTTPProxy(ctx, proxyURL, addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if secure {
+		config := tlsConfig.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	if header != nil {
+		req.Header = header.Clone()
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("WebSocket handshake with %s failed: %s", u.Host, resp.Status)
+	}
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") || !headerHasToken(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+		return nil, fmt.Errorf("WebSocket handshake with %s failed: invalid upgrade response", u.Host)
+	}
+
+	return &wsConn{Conn: conn, r: r}, nil
+}
+
+// headerHasToken reports whether the comma-separated values of the header
+// name include token, ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dialHTTPProxy opens a tunnel to addr through the HTTP proxy at proxyURL
+// with a CONNECT request.
+func dialHTTPProxy(ctx context.Context, proxyURL *url.URL, addr string) (_ net.Conn, err error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	switch proxyURL.Scheme {
+	case "http":
+	case "https":
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	default:
+		return nil, fmt.Errorf("Unsupported proxy URL scheme %q", proxyURL.Scheme)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Proxy %s refused to connect to %s: %s", proxyURL.Host, addr, resp.Status)
+	}
+	// The server doesn't speak before the client, anything more is the
+	// proxy misbehaving.
+	if r.Buffered() > 0 {
+		return nil, fmt.Errorf("Proxy %s sent unexpected data after connecting to %s", proxyURL.Host, addr)
+	}
+	return conn, nil
+}
+
+// wsConn sends and receives the bytes of the connection as binary WebSocket
+// messages.
+type wsConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	// The payload of the data frame being read.
+	remaining int64
+	mask      [4]byte
+	masked    bool
+	maskPos   int
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	if c.masked {
+		for i := range p[:n] {
+			p[i] ^= c.mask[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers up to the next data frame, answering the
+// control frames on the way.
+func (c *wsConn) nextFrame() error {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return err
+	}
+	opcode := head[0] & 0x0f
+	c.masked = head[1]&0x80 != 0
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+	if c.masked {
+		if _, err := io.ReadFull(c.r, c.mask[:]); err != nil {
+			return err
+		}
+	}
+	c.maskPos = 0
+
+	switch opcode {
+	case wsContinuation, wsText, wsBinary:
+		c.remaining = length
+		return nil
+	}
+
+	// Control frames carry at most 125 bytes.
+	if length > 125 {
+		return errors.New("Invalid WebSocket control frame")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return err
+	}
+	if c.masked {
+		for i := range payload {
+			payload[i] ^= c.mask[i%4]
+		}
+	}
+	switch opcode {
+	case wsPing:
+		return c.writeFrame(wsPong, payload)
+	case wsClose:
+		c.writeFrame(wsClose, payload)
+		return io.EOF
+	}
+	return nil
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame writes a single masked frame, as clients have to.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	if opcode == wsClose {
+		c.closed = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+func (c *wsConn) Close() error {
+	// Best effort, the server may already be gone.
+	c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, 1000))
+	return c.Conn.Close()
+}
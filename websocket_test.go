@@ -0,0 +1,251 @@
+package simplessh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// wsFrame encodes a single frame, masked with mask if it isn't nil.
+func wsFrame(fin bool, opcode byte, payload []byte, mask []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	var maskBit byte
+	if mask != nil {
+		maskBit = 0x80
+	}
+
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(len(payload)))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(len(payload)))
+	}
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readWSFrame reads a frame as a server does, returning the length field as
+// sent: 126 and 127 for the extended lengths.
+func readWSFrame(r io.Reader) (head byte, lengthField byte, payload []byte, err error) {
+	var b [2]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	if b[1]&0x80 == 0 {
+		return 0, 0, nil, io.ErrUnexpectedEOF
+	}
+	lengthField = b[1] & 0x7f
+	length := uint64(lengthField)
+	switch lengthField {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return b[0], lengthField, payload, nil
+}
+
+func newWSPipe() (*wsConn, net.Conn) {
+	client, server := net.Pipe()
+	return &wsConn{Conn: client, r: bufio.NewReader(client)}, server
+}
+
+func TestWSConnWrite(t *testing.T) {
+	tests := []struct {
+		size        int
+		lengthField byte
+	}{
+		{0, 0},
+		{1, 1},
+		{125, 125},
+		{126, 126},
+		{0xffff, 126},
+		{0x10000, 127},
+	}
+	for _, tt := range tests {
+		ws, server := newWSPipe()
+		payload := bytes.Repeat([]byte("ssh"), tt.size/3+1)[:tt.size]
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := ws.Write(payload)
+			errc <- err
+		}()
+		head, lengthField, got, err := readWSFrame(server)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tt.size, err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("%d bytes: %v", tt.size, err)
+		}
+
+		if head != 0x80|wsBinary {
+			t.Errorf("%d bytes: first byte = %#x, want a final binary frame", tt.size, head)
+		}
+		if lengthField != tt.lengthField {
+			t.Errorf("%d bytes: length field = %d, want %d", tt.size, lengthField, tt.lengthField)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes: payload differs", tt.size)
+		}
+		server.Close()
+	}
+}
+
+func TestWSConnRead(t *testing.T) {
+	long := bytes.Repeat([]byte{0x5a}, 70000)
+	mask := []byte{1, 2, 3, 4}
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   []byte
+		pongs  [][]byte
+	}{
+		{"empty", [][]byte{wsFrame(true, wsBinary, nil, nil)}, nil, nil},
+		{"binary", [][]byte{wsFrame(true, wsBinary, []byte("SSH-2.0-OpenSSH\r\n"), nil)}, []byte("SSH-2.0-OpenSSH\r\n"), nil},
+		{"16-bit length", [][]byte{wsFrame(true, wsBinary, long[:300], nil)}, long[:300], nil},
+		{"64-bit length", [][]byte{wsFrame(true, wsBinary, long, nil)}, long, nil},
+		{"masked", [][]byte{wsFrame(true, wsBinary, []byte("masked data"), mask)}, []byte("masked data"), nil},
+		{
+			"fragmented",
+			[][]byte{
+				wsFrame(false, wsBinary, []byte("frag"), nil),
+				wsFrame(false, wsContinuation, []byte("men"), nil),
+				wsFrame(true, wsContinuation, []byte("ted"), nil),
+			},
+			[]byte("fragmented"),
+			nil,
+		},
+		{
+			"ping",
+			[][]byte{
+				wsFrame(true, wsBinary, []byte("before "), nil),
+				wsFrame(true, wsPing, []byte("are you there"), nil),
+				wsFrame(true, wsBinary, []byte("after"), nil),
+			},
+			[]byte("before after"),
+			[][]byte{[]byte("are you there")},
+		},
+		{
+			"masked ping",
+			[][]byte{wsFrame(true, wsPing, []byte("hi"), mask), wsFrame(true, wsBinary, []byte("x"), nil)},
+			[]byte("x"),
+			[][]byte{[]byte("hi")},
+		},
+		{"pong", [][]byte{wsFrame(true, wsPong, []byte("unsolicited"), nil), wsFrame(true, wsBinary, []byte("x"), nil)}, []byte("x"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, server := newWSPipe()
+			defer server.Close()
+
+			// The pipe is synchronous: frames are sent and the client's
+			// frames read on their own.
+			go func() {
+				for _, frame := range tt.frames {
+					if _, err := server.Write(frame); err != nil {
+						return
+					}
+				}
+				server.Write(wsFrame(true, wsClose, binary.BigEndian.AppendUint16(nil, 1000), nil))
+			}()
+			type frame struct {
+				head    byte
+				payload []byte
+			}
+			frames := make(chan frame)
+			go func() {
+				defer close(frames)
+				for {
+					head, _, payload, err := readWSFrame(server)
+					if err != nil {
+						return
+					}
+					frames <- frame{head, payload}
+				}
+			}()
+			var pongs [][]byte
+			closed := make(chan []byte, 1)
+			go func() {
+				for f := range frames {
+					switch f.head {
+					case 0x80 | wsPong:
+						pongs = append(pongs, f.payload)
+					case 0x80 | wsClose:
+						closed <- f.payload
+					}
+				}
+			}()
+
+			got, err := io.ReadAll(ws)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+
+			// The close frame is echoed after the pongs.
+			if payload := <-closed; !bytes.Equal(payload, binary.BigEndian.AppendUint16(nil, 1000)) {
+				t.Errorf("close payload = %x, want 03e8", payload)
+			}
+			if len(pongs) != len(tt.pongs) {
+				t.Fatalf("got %d pongs, want %d", len(pongs), len(tt.pongs))
+			}
+			for i := range pongs {
+				if !bytes.Equal(pongs[i], tt.pongs[i]) {
+					t.Errorf("pong %d = %q, want %q", i, pongs[i], tt.pongs[i])
+				}
+			}
+
+			if _, err := ws.Write([]byte("late")); err == nil {
+				t.Error("Write after the close frame didn't fail")
+			}
+		})
+	}
+}
+
+func TestWSConnInvalidControlFrame(t *testing.T) {
+	ws, server := newWSPipe()
+	defer server.Close()
+
+	go server.Write(wsFrame(true, wsPing, make([]byte, 126), nil))
+	if _, err := ws.Read(make([]byte, 10)); err == nil || err == io.EOF {
+		t.Errorf("Read = %v, want an error", err)
+	}
+}
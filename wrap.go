@@ -0,0 +1,68 @@
+package simplessh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NewClientFromSSH returns a Client running commands and transfers over an
+// SSH connection established elsewhere, which it takes ownership of: closing
+// the Client closes client. The options about running commands, such as
+// logging, metrics, WithAgentForwarding and WithMaxSessions, apply; those about
+// connecting, such as host key checks, timeouts and dialers, are ignored.
+func NewClientFromSSH(client *ssh.Client, opts ...Option) (*Client, error) {
+	o := newOptions(append(opts, withoutSpill()))
+
+	host, username := client.RemoteAddr().String(), client.User()
+	c := &Client{}
+	o.setupClient(c, client)
+	c.logger, c.host, c.user, c.tracer, c.metrics, c.auditLog, c.plan = o.log().With("host", host, "user", username), host, username, o.tracer, o.metrics, o.audit, o.plan
+
+	if o.forwardAgent {
+		if err := c.forwardAgent(); err != nil {
+			if c.agentConn != o.agentConn {
+				c.agentConn.Close()
+			}
+			o.connectFailed(host, username, err)
+			return nil, err
+		}
+	}
+
+	o.recorder().ConnectionOpened(host)
+	c.watchConnection()
+	o.connected(c)
+	return c, nil
+}
+
+// ConnectOverConn establishes the SSH connection over conn instead of dialing
+// host, for connections set up by the caller such as over a transport
+// simplessh doesn't know about. host is still needed to check the host key.
+// The Client takes ownership of conn, which is closed if connecting fails.
+// Retries and WithSpillConnections don't apply since conn can only be used
+// once.
+func ConnectOverConn(conn net.Conn, host, username string, chain AuthChain, opts ...Option) (*Client, error) {
+	var used atomic.Bool
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if used.Swap(true) {
+			return nil, errors.New("The connection given to ConnectOverConn was already used")
+		}
+		return conn, nil
+	}
+
+	c, err := ConnectWithAuthChain(host, username, chain, append(opts, WithDialer(dial), WithRetry(RetryPolicy{}), withoutSpill())...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func withoutSpill() Option {
+	return func(o *options) {
+		o.spillConns = 0
+	}
+}
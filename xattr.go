@@ -0,0 +1,113 @@
+package simplessh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// WithXattrs copies the file's extended attributes along with it, which
+// includes POSIX ACLs and security labels such as SELinux contexts. They're
+// read and written with getfattr and setfattr on both ends, so these need to
+// be installed locally and on the remote host, and writing security
+// attributes needs WithBecome on the remote host. Upload and Download return
+// an error if the attributes couldn't be copied.
+func WithXattrs() TransferOption {
+	return func(o *transferOptions) {
+		o.xattrs = true
+	}
+}
+
+// xattrDumpArgs make getfattr dump all of a file's attributes.
+var xattrDumpArgs = []string{"--dump", "--match=-", "--encoding=base64", "--absolute-names", "--"}
+
+// uploadXattrs copies the extended attributes of local to remote.
+func (c *Client) uploadXattrs(local, remote string) error {
+	if err := c.checkXattrs(); err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("getfattr", append(xattrDumpArgs, local)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Couldn't read the extended attributes of %s: %w: %s", local, err, strings.TrimSpace(stderr.String()))
+	}
+
+	dump := retargetXattrs(stdout.Bytes(), remote)
+	if dump == nil {
+		return nil
+	}
+	if _, err := c.fileExec("setfattr --restore=-", bytes.NewReader(dump)); err != nil {
+		return fmt.Errorf("Couldn't set the extended attributes of %s: %w", remote, err)
+	}
+	return nil
+}
+
+// downloadXattrs copies the extended attributes of remote to local.
+func (c *Client) downloadXattrs(remote, local string) error {
+	if err := c.checkXattrs(); err != nil {
+		return err
+	}
+
+	output, err := c.fileExec("getfattr "+strings.Join(xattrDumpArgs, " ")+" "+Quote(remote), nil)
+	if err != nil {
+		return fmt.Errorf("Couldn't read the extended attributes of %s: %w", remote, err)
+	}
+
+	dump := retargetXattrs(output, local)
+	if dump == nil {
+		return nil
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("setfattr", "--restore=-")
+	cmd.Stdin, cmd.Stderr = bytes.NewReader(dump), &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Couldn't set the extended attributes of %s: %w: %s", local, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (c *Client) checkXattrs() error {
+	if runtime.GOOS == "windows" || c.platform.Windows() {
+		return errors.New("Extended attributes aren't supported on Windows")
+	}
+	return nil
+}
+
+// retargetXattrs rewrites the "# file:" line of a getfattr dump of a single
+// file to name path instead, or returns nil if the file has no attributes.
+func retargetXattrs(dump []byte, path string) []byte {
+	var out bytes.Buffer
+	out.WriteString("# file: " + escapeXattrPath(path) + "\n")
+
+	found := false
+	for _, line := range strings.Split(string(dump), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		found = true
+		out.WriteString(line + "\n")
+	}
+	if !found {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// escapeXattrPath escapes path for setfattr, with octal escapes for
+// backslashes, "=" and control characters.
+func escapeXattrPath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		if c == '\\' || c < ' ' || c == 0x7f || c == '=' {
+			fmt.Fprintf(&b, "\\%03o", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
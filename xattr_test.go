@@ -0,0 +1,49 @@
+package simplessh
+
+import "testing"
+
+func TestEscapeXattrPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/srv/app/config.yml", "/srv/app/config.yml"},
+		{"/srv/with space/é", "/srv/with space/é"},
+		{`C:\temp`, `C:\134temp`},
+		{"a=b", `a\075b`},
+		{"line\nbreak", `line\012break`},
+		{"tab\there", `tab\011here`},
+		{"del\x7f", `del\177`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeXattrPath(tt.path); got != tt.want {
+			t.Errorf("escapeXattrPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRetargetXattrs(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		path string
+		want string
+	}{
+		{
+			"attributes",
+			"# file: srv/app/data\nuser.origin=\"upload\"\nuser.checksum=0sAQID\n\n",
+			"/tmp/data=1",
+			"# file: /tmp/data\\0751\nuser.origin=\"upload\"\nuser.checksum=0sAQID\n",
+		},
+		{"no attributes", "# file: srv/app/data\n\n", "/tmp/data", ""},
+		{"empty", "", "/tmp/data", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(retargetXattrs([]byte(tt.dump), tt.path)); got != tt.want {
+				t.Errorf("retargetXattrs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}